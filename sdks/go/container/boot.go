@@ -119,6 +119,7 @@ func main() {
 		"--id=" + *id,
 		"--logging_endpoint=" + *loggingEndpoint,
 		"--control_endpoint=" + *controlEndpoint,
+		"--provision_endpoint=" + *provisionEndpoint,
 		"--semi_persist_dir=" + *semiPersistDir,
 		"--options=" + options,
 	}
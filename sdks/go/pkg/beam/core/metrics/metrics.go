@@ -69,6 +69,12 @@ type ctxKey string
 const bundleKey ctxKey = "beam:bundle"
 const ptransformKey ctxKey = "beam:ptransform"
 
+func init() {
+	// Log messages are correlated with the bundle and ptransform as well.
+	log.RegisterContextKey(bundleKey)
+	log.RegisterContextKey(ptransformKey)
+}
+
 // beamCtx is a caching context for IDs necessary to place metric updates.
 //  Allocating contexts and searching for PTransformIDs for every element
 // is expensive, so we avoid it if possible.
@@ -82,14 +88,14 @@ func (ctx *beamCtx) Value(key interface{}) interface{} {
 	switch key {
 	case bundleKey:
 		if ctx.bundleID == "" {
-			if id := ctx.Value(key); id != nil {
+			if id := ctx.Context.Value(key); id != nil {
 				ctx.bundleID = id.(string)
 			}
 		}
 		return ctx.bundleID
 	case ptransformKey:
 		if ctx.ptransformID == "" {
-			if id := ctx.Value(key); id != nil {
+			if id := ctx.Context.Value(key); id != nil {
 				ctx.ptransformID = id.(string)
 			}
 		}
@@ -118,6 +124,12 @@ func SetPTransformID(ctx context.Context, id string) context.Context {
 	return &beamCtx{Context: ctx, ptransformID: id}
 }
 
+// GetPTransformID returns the id of the current PTransform, if set.
+func GetPTransformID(ctx context.Context) (string, bool) {
+	id, _ := ctx.Value(ptransformKey).(string)
+	return id, id != ""
+}
+
 func getContextKey(ctx context.Context, n name) key {
 	key := key{name: n, bundle: "(bundle id unset)", ptransform: "(ptransform id unset)"}
 	if id := ctx.Value(bundleKey); id != nil {
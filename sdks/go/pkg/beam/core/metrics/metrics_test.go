@@ -396,3 +396,17 @@ func BenchmarkMetrics(b *testing.B) {
 		})
 	}
 }
+
+func TestGetPTransformID(t *testing.T) {
+	if id, ok := GetPTransformID(context.Background()); ok {
+		t.Errorf("GetPTransformID(background) = %q, want none", id)
+	}
+	// Only the bundle is known while a bundle is started, which used to
+	// recurse indefinitely on lookup of the unset ptransform.
+	if id, ok := GetPTransformID(SetBundleID(context.Background(), bID)); ok {
+		t.Errorf("GetPTransformID(bundle only) = %q, want none", id)
+	}
+	if id, ok := GetPTransformID(ctxWith(bID, "pt")); !ok || id != "pt" {
+		t.Errorf("GetPTransformID(ctxWith(%q, %q)) = %q, %v, want %q", bID, "pt", id, ok, "pt")
+	}
+}
@@ -20,10 +20,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/apache/beam/sdks/go/pkg/beam/core/runtime"
 	"github.com/apache/beam/sdks/go/pkg/beam/core/runtime/exec"
+	"github.com/apache/beam/sdks/go/pkg/beam/core/runtime/harness/logging"
 	"github.com/apache/beam/sdks/go/pkg/beam/core/util/hooks"
 	"github.com/apache/beam/sdks/go/pkg/beam/log"
 	fnpb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
@@ -34,6 +38,16 @@ import (
 
 // TODO(herohde) 2/8/2017: for now, assume we stage a full binary (not a plugin).
 
+// shutdownDrainTimeout bounds how long Main waits for the buffered log
+// entries to be sent before returning.
+const shutdownDrainTimeout = 10 * time.Second
+
+// LoggingOptions configures the remote logging set up by Main, such as its
+// sinks and routes. It must be set before Main, such as from an init hook.
+// Unless they are set, the minimum severity and the package levels are read
+// from the worker_log_level and worker_log_package_levels pipeline options.
+var LoggingOptions logging.Options
+
 // Main is the main entrypoint for the Go harness. It runs at "runtime" -- not
 // "pipeline-construction time" -- on each worker. It is a FnAPI client and
 // ultimately responsible for correctly executing user code.
@@ -41,7 +55,35 @@ func Main(ctx context.Context, loggingEndpoint, controlEndpoint string) error {
 	hooks.DeserializeHooksFromOptions(ctx)
 
 	hooks.RunInitHooks(ctx)
-	setupRemoteLogging(ctx, loggingEndpoint)
+	opts := LoggingOptions
+	level, err := logging.ParseLevel(runtime.GlobalOptions.Get("worker_log_level"))
+	if opts.Level == log.SevUnspecified {
+		opts.Level = level
+	}
+	packageLevels, perr := logging.ParsePackageLevels(runtime.GlobalOptions.Get("worker_log_package_levels"))
+	if opts.PackageLevels == nil {
+		opts.PackageLevels = packageLevels
+	}
+	// The batches sent are recorded for session capture, if enabled.
+	opts.Hooks = append(opts.Hooks[:len(opts.Hooks):len(opts.Hooks)], func(list *fnpb.LogEntry_List) {
+		recordLogEntries(list)
+	})
+	remote := logging.Start(ctx, loggingEndpoint, opts)
+	// The process typically exits once Main returns, so the buffered log
+	// entries are sent first. This runs after a panic is logged.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownDrainTimeout)
+		defer cancel()
+		remote.Drain(ctx)
+	}()
+	defer remote.FlushOnPanic(ctx)
+	defer remote.DrainOnSignal(syscall.SIGTERM)()
+	if err != nil {
+		log.Warn(ctx, err)
+	}
+	if perr != nil {
+		log.Warn(ctx, perr)
+	}
 	recordHeader()
 
 	// Connect to FnAPI control server. Receive and execute work.
@@ -87,6 +129,8 @@ func Main(ctx context.Context, loggingEndpoint, controlEndpoint string) error {
 		state:  &StateChannelManager{},
 	}
 
+	var bundles int64 // number of bundles processed, only used by this goroutine
+
 	// gRPC requires all readers of a stream be the same goroutine, so this goroutine
 	// is responsible for managing the network data. All it does is pull data from
 	// the stream, and hand off the message to a goroutine to actually be handled,
@@ -124,7 +168,14 @@ func Main(ctx context.Context, loggingEndpoint, controlEndpoint string) error {
 		if req.GetProcessBundle() != nil {
 			// Only process bundles in a goroutine. We at least need to process instructions for
 			// each plan serially. Perhaps just invoke plan.Execute async?
-			go fn(ctx, req)
+			// Each bundle is tagged with a sequence number, so that the log
+			// entries of concurrent bundles can be told apart.
+			bundles++
+			ctx := logging.WithThreadID(ctx, "bundle-"+strconv.FormatInt(bundles, 10))
+			go func(ctx context.Context, req *fnpb.InstructionRequest) {
+				defer remote.FlushOnPanic(ctx)
+				fn(ctx, req)
+			}(ctx, req)
 		} else {
 			fn(ctx, req)
 		}
@@ -145,7 +196,7 @@ type control struct {
 
 func (c *control) handleInstruction(ctx context.Context, req *fnpb.InstructionRequest) *fnpb.InstructionResponse {
 	id := req.GetInstructionId()
-	ctx = setInstID(ctx, id)
+	ctx = log.WithInstructionID(ctx, id)
 
 	switch {
 	case req.GetRegister() != nil:
@@ -213,7 +264,7 @@ func (c *control) handleInstruction(ctx context.Context, req *fnpb.InstructionRe
 			InstructionId: id,
 			Response: &fnpb.InstructionResponse_ProcessBundle{
 				ProcessBundle: &fnpb.ProcessBundleResponse{
-					Metrics: m,
+					Metrics: logging.AddMetrics(m),
 				},
 			},
 		}
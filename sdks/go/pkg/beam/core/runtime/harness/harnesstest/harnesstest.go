@@ -0,0 +1,71 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package harnesstest contains helpers for testing code that logs with the
+// log package as it would on a worker.
+package harnesstest
+
+import (
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/core/runtime/harness/logging"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// NewTestLogSink returns a logging.Sink that writes each entry to the log of
+// the test with t.Logf, along with its severity and location, so that it is
+// shown interleaved with the output of the test, and only for the test that
+// logged it. See UseTestLogSink.
+func NewTestLogSink(t testing.TB) logging.Sink {
+	return testLogSink{t: t}
+}
+
+type testLogSink struct {
+	t testing.TB
+}
+
+func (s testLogSink) Send(list *pb.LogEntry_List) error {
+	s.t.Helper()
+	for _, entry := range list.GetLogEntries() {
+		s.t.Logf("%v", formatTestEntry(entry))
+	}
+	return nil
+}
+
+// formatTestEntry formats an entry for the test log, such as
+// "INFO foo/bar.go:12] message".
+func formatTestEntry(entry *pb.LogEntry) string {
+	line := entry.GetSeverity().String()
+	if loc := entry.GetLogLocation(); loc != "" {
+		line += " " + loc
+	}
+	line += "] " + entry.GetMessage()
+	if trace := entry.GetTrace(); trace != "" {
+		line += "\n" + trace
+	}
+	return line
+}
+
+// UseTestLogSink installs a logger that writes the messages logged with the
+// log package to the log of the test, using NewTestLogSink, until the
+// returned function is called, which should be deferred by the test. It lets
+// the DoFns run by a unit test log as they do on a worker. Each message is
+// written before the logging call returns. The logger is global, so tests
+// using it must not run in parallel.
+//
+//	defer harnesstest.UseTestLogSink(t)()
+func UseTestLogSink(t testing.TB) func() {
+	return logging.UseSink(NewTestLogSink(t))
+}
@@ -0,0 +1,67 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harnesstest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// fakeTB records the messages logged to it.
+type fakeTB struct {
+	testing.TB
+
+	mu   sync.Mutex
+	logs []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Logf(format string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs = append(f.logs, fmt.Sprintf(format, args...))
+}
+
+func TestUseTestLogSink(t *testing.T) {
+	prev := log.GetLogger()
+	tb := &fakeTB{}
+	restore := UseTestLogSink(tb)
+
+	ctx := context.Background()
+	log.Warn(ctx, "to the test log")
+
+	// The message is written before Warn returns.
+	tb.mu.Lock()
+	logs := append([]string(nil), tb.logs...)
+	tb.mu.Unlock()
+	if len(logs) != 1 {
+		t.Fatalf("test log = %q, want a single message", logs)
+	}
+	if !regexp.MustCompile(`^WARN harnesstest/harnesstest_test.go:\d+\] to the test log$`).MatchString(logs[0]) {
+		t.Errorf("test log message = %q, want the severity, location and message", logs[0])
+	}
+
+	restore()
+	if log.GetLogger() != prev {
+		t.Errorf("logger not restored once the test completed")
+	}
+}
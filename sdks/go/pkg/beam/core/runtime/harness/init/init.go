@@ -39,11 +39,12 @@ var (
 
 	worker = flag.Bool("worker", false, "Whether binary is running in worker mode.")
 
-	id              = flag.String("id", "", "Local identifier (required in worker mode).")
-	loggingEndpoint = flag.String("logging_endpoint", "", "Local logging gRPC endpoint (required in worker mode).")
-	controlEndpoint = flag.String("control_endpoint", "", "Local control gRPC endpoint (required in worker mode).")
-	semiPersistDir  = flag.String("semi_persist_dir", "/tmp", "Local semi-persistent directory (optional in worker mode).")
-	options         = flag.String("options", "", "JSON-encoded pipeline options (required in worker mode).")
+	id                = flag.String("id", "", "Local identifier (required in worker mode).")
+	loggingEndpoint   = flag.String("logging_endpoint", "", "Local logging gRPC endpoint (required in worker mode).")
+	controlEndpoint   = flag.String("control_endpoint", "", "Local control gRPC endpoint (required in worker mode).")
+	provisionEndpoint = flag.String("provision_endpoint", "", "Local provision gRPC endpoint, for the labels attached to log entries (optional in worker mode).")
+	semiPersistDir    = flag.String("semi_persist_dir", "/tmp", "Local semi-persistent directory (optional in worker mode).")
+	options           = flag.String("options", "", "JSON-encoded pipeline options (required in worker mode).")
 )
 
 func init() {
@@ -83,6 +84,9 @@ func hook() {
 	// does, and establish the background context here.
 
 	ctx := grpcx.WriteWorkerID(context.Background(), *id)
+	if *provisionEndpoint != "" {
+		harness.LoggingOptions.ProvisionEndpoint = *provisionEndpoint
+	}
 	if err := harness.Main(ctx, *loggingEndpoint, *controlEndpoint); err != nil {
 		fmt.Fprintf(os.Stderr, "Worker failed: %v", err)
 		os.Exit(1)
@@ -0,0 +1,98 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// binding holds the references and fields of a context, looked up once by
+// logger.With for all the messages logged with it.
+type binding struct {
+	inst, transform, thread string
+	fields                  log.Fields
+}
+
+func newBinding(ctx context.Context) *binding {
+	b := &binding{fields: log.FieldsFromContext(ctx)}
+	b.inst, _ = tryGetInstID(ctx)
+	b.transform, _ = tryGetTransformID(ctx)
+	b.thread, _ = tryGetThreadID(ctx)
+	return b
+}
+
+// mergeFields returns the fields of a message logged with ctx: those of the
+// binding, overridden by those of ctx, or only the latter if b is nil.
+func (b *binding) mergeFields(ctx context.Context) log.Fields {
+	fields := log.FieldsFromContext(ctx)
+	if b == nil || len(b.fields) == 0 {
+		return fields
+	}
+	if len(fields) == 0 {
+		return b.fields
+	}
+	merged := make(log.Fields, len(b.fields)+len(fields))
+	for k, v := range b.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}
+
+// setReferences sets the references of the entry from the binding, or from
+// ctx if b is nil.
+func (b *binding) setReferences(ctx context.Context, entry *pb.LogEntry) {
+	if b == nil {
+		setReferences(ctx, entry)
+		return
+	}
+	entry.InstructionReference = b.inst
+	entry.PrimitiveTransformReference = b.transform
+	entry.Thread = b.thread
+}
+
+// With returns a logger bound to the instruction, transform and fields of
+// ctx. It implements log.Binder.
+func (l *logger) With(ctx context.Context) log.Logger {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return boundLogger{l: l, b: newBinding(ctx)}
+}
+
+// boundLogger logs to the logger with the references and fields of its
+// binding.
+type boundLogger struct {
+	l *logger
+	b *binding
+}
+
+func (bl boundLogger) Log(ctx context.Context, sev log.Severity, calldepth int, msg string) {
+	bl.l.log(ctx, bl.b, sev, calldepth, msg)
+}
+
+func (bl boundLogger) Enabled(ctx context.Context, sev log.Severity) bool {
+	return bl.l.Enabled(ctx, sev)
+}
+
+func (bl boundLogger) Flush(ctx context.Context) error {
+	return bl.l.Flush(ctx)
+}
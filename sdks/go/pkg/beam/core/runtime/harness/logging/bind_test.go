@@ -0,0 +1,57 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogWith(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	l := &logger{out: buf, stats: &logStats{}}
+
+	ctx := metrics.SetPTransformID(log.WithInstructionID(context.Background(), "inst"), "ptransform")
+	ctx = log.WithFields(ctx, log.Fields{"bound": "yes", "key": "bound"})
+	bl := l.With(ctx)
+
+	// The references of the later context are ignored, but its fields are
+	// merged.
+	later := log.WithFields(log.WithInstructionID(context.Background(), "other"), log.Fields{"key": "later"})
+	_, _, line, _ := runtime.Caller(0)
+	bl.Log(later, log.SevInfo, 1, "msg")
+
+	entry := <-buf
+	if got, want := entry.GetMessage(), "msg bound=yes key=later"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if got := entry.GetInstructionReference(); got != "inst" {
+		t.Errorf("InstructionReference = %q, want %q", got, "inst")
+	}
+	if got := entry.GetPrimitiveTransformReference(); got != "ptransform" {
+		t.Errorf("PrimitiveTransformReference = %q, want %q", got, "ptransform")
+	}
+	if want := "logging/bind_test.go:" + strconv.Itoa(line+1); !strings.HasSuffix(entry.GetLogLocation(), want) {
+		t.Errorf("LogLocation = %q, want %q", entry.GetLogLocation(), want)
+	}
+}
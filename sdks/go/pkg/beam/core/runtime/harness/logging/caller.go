@@ -0,0 +1,55 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// callerFailureThreshold is the number of consecutive messages without a
+// caller after which the logger warns that log locations are unavailable.
+// A single failure can be legitimate, such as a message logged from the top
+// of a goroutine, but a run of them points to a wrapper passing the wrong
+// calldepth.
+const callerFailureThreshold = 10
+
+// missingCaller counts a failed caller lookup for a message logged with the
+// calldepth, and warns once, the first time callerFailureThreshold
+// consecutive lookups have failed.
+func (l *logger) missingCaller(calldepth int) {
+	if atomic.LoadInt32(&l.callerWarned) != 0 {
+		return
+	}
+	if atomic.AddInt32(&l.callerFailures, 1) < callerFailureThreshold {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&l.callerWarned, 0, 1) {
+		return
+	}
+	msg := fmt.Sprintf("Log locations are unavailable: no caller was found for %d consecutive messages, the last logged with calldepth %d. A logging wrapper may be passing the wrong calldepth.", callerFailureThreshold, calldepth)
+	l.write(context.Background(), log.SevWarn, newEntry(l.timeNow(), l.severity(log.SevWarn), msg))
+}
+
+// foundCaller resets the count of consecutive failed caller lookups.
+func (l *logger) foundCaller() {
+	if atomic.LoadInt32(&l.callerFailures) != 0 {
+		atomic.StoreInt32(&l.callerFailures, 0)
+	}
+}
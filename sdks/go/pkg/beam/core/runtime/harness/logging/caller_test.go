@@ -0,0 +1,55 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogMissingCaller(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 100)
+	l := &logger{out: buf, priority: make(chan *pb.LogEntry, 10), stats: &logStats{}}
+	ctx := context.Background()
+
+	// A lookup that succeeds resets the count.
+	for i := 0; i < callerFailureThreshold-1; i++ {
+		l.Log(ctx, log.SevInfo, 100, "no caller")
+	}
+	l.Log(ctx, log.SevInfo, 1, "caller")
+	for i := 0; i < callerFailureThreshold-1; i++ {
+		l.Log(ctx, log.SevInfo, 100, "no caller")
+	}
+	if len(l.priority) != 0 {
+		t.Fatalf("warned before %v consecutive failures", callerFailureThreshold)
+	}
+
+	// Only the first run of failures warns.
+	for i := 0; i < 3*callerFailureThreshold; i++ {
+		l.Log(ctx, log.SevInfo, 100, "no caller")
+	}
+	if len(l.priority) != 1 {
+		t.Fatalf("warned %v times, want once", len(l.priority))
+	}
+	entry := <-l.priority
+	if entry.GetSeverity() != pb.LogEntry_Severity_WARN || !strings.Contains(entry.GetMessage(), "calldepth 100") {
+		t.Errorf("warning = %v %q, want WARN naming calldepth 100", entry.GetSeverity(), entry.GetMessage())
+	}
+}
@@ -0,0 +1,570 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Config is a snapshot of the effective configuration and state of the
+// remote logging, for diagnostics.
+type Config struct {
+	// Endpoint is the FnLogging endpoint, unless the entries go to Sink
+	// instead, which is then the type of the sink.
+	Endpoint string
+	Sink     string
+	// Sinks is the number of additional sinks. See Options.Sinks and
+	// Options.Routes.
+	Sinks int
+	// Level is the minimum severity of the entries sent.
+	Level log.Severity
+	// BufferSize and BufferBytes are the capacity of the buffer, in entries
+	// and approximate bytes.
+	BufferSize  int
+	BufferBytes int64
+	// BatchSize and MaxBatchBytes bound the batches sent, which are sent
+	// at least every FlushInterval.
+	BatchSize     int
+	MaxBatchBytes int
+	FlushInterval time.Duration
+	// Synchronous is set if each logging call waits for its entry to be
+	// sent.
+	Synchronous bool
+	// AtLeastOnce is set if the entries in transit when a stream fails are
+	// sent again.
+	AtLeastOnce bool
+	// Muted and Draining are set while logging is muted, and once it is
+	// being drained. See Mute.
+	Muted    bool
+	Draining bool
+	// Buffered is the number of entries currently buffered.
+	Buffered int
+	// Dropped, Sampled and Suppressed are the numbers of entries dropped
+	// by buffer pressure or failed sends, by sampling, and while muted.
+	Dropped    int64
+	Sampled    int64
+	Suppressed int64
+	// LastError is the last failure of the writer since it last connected.
+	LastError error
+}
+
+// String returns the configuration in a single line of key=value pairs, such
+// as to log it.
+func (c Config) String() string {
+	fields := log.Fields{
+		"level":           convertSeverity(c.Level).String(),
+		"sinks":           strconv.Itoa(c.Sinks),
+		"buffer_size":     strconv.Itoa(c.BufferSize),
+		"buffer_bytes":    strconv.FormatInt(c.BufferBytes, 10),
+		"batch_size":      strconv.Itoa(c.BatchSize),
+		"max_batch_bytes": strconv.Itoa(c.MaxBatchBytes),
+		"flush_interval":  c.FlushInterval.String(),
+		"synchronous":     strconv.FormatBool(c.Synchronous),
+		"at_least_once":   strconv.FormatBool(c.AtLeastOnce),
+		"muted":           strconv.FormatBool(c.Muted),
+		"draining":        strconv.FormatBool(c.Draining),
+		"buffered":        strconv.Itoa(c.Buffered),
+		"dropped":         strconv.FormatInt(c.Dropped, 10),
+		"sampled":         strconv.FormatInt(c.Sampled, 10),
+		"suppressed":      strconv.FormatInt(c.Suppressed, 10),
+	}
+	if c.Sink != "" {
+		fields["sink"] = c.Sink
+	} else {
+		fields["endpoint"] = c.Endpoint
+	}
+	if c.LastError != nil {
+		fields["last_error"] = c.LastError.Error()
+	}
+	return appendFields("Logging config:", fields)
+}
+
+// CurrentConfig returns a snapshot of the configuration of the remote
+// logging, and false if it isn't set up.
+func CurrentConfig() (Config, bool) {
+	if l, ok := log.GetLogger().(*logger); ok {
+		return l.Config(), true
+	}
+	return Config{}, false
+}
+
+// Config returns a snapshot of the configuration and state of the logger.
+func (l *logger) Config() Config {
+	c := l.config
+	c.Sinks = len(l.tees)
+	c.Level = log.Severity(atomic.LoadInt32(&l.level))
+	c.BufferSize = cap(l.out)
+	c.BufferBytes = l.maxBytes
+	c.Synchronous = l.synchronous
+	c.Muted = atomic.LoadInt32(&l.muted) != 0
+	c.Draining = atomic.LoadInt32(&l.draining) != 0
+	c.Buffered = len(l.out) + len(l.priority)
+	c.Dropped = atomic.LoadInt64(&l.stats.dropped)
+	c.Sampled = atomic.LoadInt64(&l.stats.sampled)
+	c.Suppressed = atomic.LoadInt64(&l.suppressed)
+	c.LastError = l.stats.lastError()
+	return c
+}
+
+// writerConfig returns the configuration of the writer, which the logger
+// reports along with its own.
+func (w *remoteWriter) writerConfig() Config {
+	c := Config{
+		BatchSize:     w.batchSize,
+		MaxBatchBytes: w.maxBatchBytes,
+		FlushInterval: w.flushInterval,
+		AtLeastOnce:   w.atLeastOnce,
+	}
+	if w.sink != nil {
+		c.Sink = fmt.Sprintf("%T", w.sink)
+	} else {
+		c.Endpoint = w.endpoint
+	}
+	return c
+}
+
+// Options configures remote logging. The zero value uses the defaults. The
+// exported fields are set by the program, such as from an init hook of the
+// harness, while the others are tuned with BEAM_LOG_* environment variables.
+type Options struct {
+	// Level is the minimum severity of entries sent to the runner. It can be
+	// changed at runtime with logger.setLevel.
+	Level log.Severity
+	// PackageLevels, if set, override Level for the packages under the given
+	// import path prefixes, the most specific of which applies, as matched
+	// against the function logging each entry. The empty prefix matches all
+	// packages. Entries are then filtered after looking up their caller,
+	// even if omitLocation is set. See ParsePackageLevels.
+	PackageLevels map[string]log.Severity
+	// Sink, if set, receives the entries instead of the FnLogging service at
+	// the endpoint.
+	Sink Sink
+	// Sinks receive the entries in addition to Sink, or the FnLogging
+	// service. Each buffers entries independently, so that a slow or
+	// failing sink doesn't delay the others.
+	Sinks []Sink
+	// Routes additionally receive the entries at or above their severity.
+	// Each route has its own small buffer, whose entries are dropped if it
+	// is full, so that a slow or unreachable destination never delays
+	// logging.
+	Routes []Route
+	// Hooks are called with each batch of entries sent, such as to record
+	// metrics or audit the entries that leave the worker.
+	Hooks []EntriesHook
+	// DialOptions, if set, are used to connect to the FnLogging service,
+	// such as with transport credentials. They replace the insecure
+	// defaults of grpcx.Dial, so they must configure transport security.
+	DialOptions []grpc.DialOption
+	// Redact, if set, matches the parts of messages that are replaced with
+	// "[REDACTED]" before the entries are buffered, so that secrets or
+	// personal data logged by mistake never leave the worker. The fields of
+	// the messages are redacted too, but not their stack traces. See
+	// CompileRedactions.
+	Redact *regexp.Regexp
+	// Severities, if set, maps the severities of messages to those of the
+	// entries, for runners that interpret the severities differently, such
+	// as to send warnings as errors. It applies to the entries of the
+	// writer itself too. The severity of the message still decides whether
+	// it is logged, and how it is buffered. If unset,
+	// DefaultSeverityMapping is used.
+	Severities SeverityMapping
+	// SpanContext, if set, looks up the trace span of each message, whose
+	// IDs are added to its fields as trace_id and span_id, so that the
+	// entries can be correlated with the traces. Messages without a span
+	// are unchanged.
+	SpanContext SpanContextFunc
+	// ProvisionEndpoint, if set, is the endpoint of the provisioning
+	// service of the worker, from which ProvisionLabels, such as the job
+	// name, are read once, so that the entries can be filtered by job
+	// downstream. They are attached to the entries as described for
+	// omitMessageFields. Labels other than "job_id" and "job_name" are the
+	// pipeline options with string values, such as "region". If
+	// ProvisionLabels is unset, the BEAM_LOG_PROVISION_LABELS environment
+	// variable, a comma-separated list, is used, falling back to
+	// defaultProvisionLabels.
+	ProvisionEndpoint string
+	ProvisionLabels   []string
+	// Diagnostics, if set, receives each failure of the writers, such as a
+	// failed attempt to connect to the runner, without blocking, so that a
+	// supervising component can observe persistent failures, and alert or
+	// restart, rather than scraping stderr.
+	Diagnostics chan<- error
+	// FallbackWriter, if set, receives the entries and reports written to
+	// stderr instead: those that can't be sent or buffered, all of them if
+	// remote logging is disabled, and the reports of the logging failures.
+	// Plain entries are only colorized on a terminal.
+	FallbackWriter io.Writer
+
+	// labelFields are the ProvisionLabels read from the provisioning
+	// service.
+	labelFields log.Fields
+	// disabled turns logging off entirely, for workers that can't afford
+	// its overhead: log.Discard is installed, and no writer is started, so
+	// nothing is sent to the runner, even if the endpoint is valid. It takes
+	// precedence over all other options, including Sink, Sinks, Routes and
+	// fileDir. It is also set if the BEAM_DISABLE_REMOTE_LOGGING environment
+	// variable is true.
+	disabled bool
+	// bufferSize is the number of entries buffered while waiting to be
+	// sent, beyond which entries are dropped. Each buffered entry holds its
+	// message, so a larger buffer trades worker memory for fewer drops
+	// under bursts of logging. If unset, the BEAM_LOG_BUFFER_SIZE
+	// environment variable is used, falling back to defaultBufferSize.
+	bufferSize int
+	// bufferBytes caps the approximate total size of the messages buffered,
+	// beyond which entries are dropped even if bufferSize isn't reached. It
+	// keeps a few huge entries from exhausting worker memory. If unset, the
+	// BEAM_LOG_BUFFER_BYTES environment variable is used, falling back to
+	// defaultBufferBytes.
+	bufferBytes int
+	// maxMessageSize is the length in bytes beyond which messages are
+	// truncated, which keeps huge messages from exceeding the gRPC message
+	// size limit. If unset, the BEAM_LOG_MAX_MESSAGE_SIZE environment
+	// variable is used, falling back to defaultMaxMessageSize.
+	maxMessageSize int
+	// traceLevel is the minimum severity of entries that get a stack trace
+	// of the logging goroutine, such as SevError. Capturing a trace is
+	// expensive, so it is skipped for less severe entries. If unset, the
+	// BEAM_LOG_TRACE_LEVEL environment variable is used, if valid, and no
+	// entries get a trace otherwise.
+	traceLevel log.Severity
+	// maxTraceSize bounds the size of the stack traces in bytes. If unset,
+	// the BEAM_LOG_MAX_TRACE_SIZE environment variable is used, if valid,
+	// falling back to defaultMaxTraceSize.
+	maxTraceSize int
+	// dropPolicy determines which entry is dropped if the buffer is full.
+	// If unset, the BEAM_LOG_DROP_POLICY environment variable is used, if
+	// valid, falling back to dropNewest. Entries exceeding bufferBytes are
+	// always dropped themselves.
+	dropPolicy dropPolicy
+	// delivery determines whether the entries in transit when a stream
+	// fails are lost, or sent again, possibly twice. If unset, the
+	// BEAM_LOG_DELIVERY environment variable is used, if valid, falling
+	// back to deliveryBestEffort.
+	delivery deliveryMode
+	// blockThreshold, if positive, is the fraction of the buffer, such as
+	// 0.9, above which a logging call waits, for up to blockTimeout, for the
+	// writer to catch up, instead of filling the buffer further, so that a
+	// burst of entries is slowed down rather than dropped. Once a wait times
+	// out, calls don't wait again until the buffer falls below the
+	// threshold, so that an unreachable endpoint doesn't slow down every
+	// call. If unset, the BEAM_LOG_BLOCK_THRESHOLD and
+	// BEAM_LOG_BLOCK_TIMEOUT environment variables are used, and calls never
+	// wait by default. If blockTimeout is unset, defaultBlockTimeout is
+	// used.
+	blockThreshold float64
+	blockTimeout   time.Duration
+	// healthInterval, if positive, is how often an INFO entry summarizing
+	// the entries sent and dropped, and the reconnects, since the previous
+	// one is logged, for deployments that don't collect the logging
+	// metrics. If unset, the BEAM_LOG_HEALTH_INTERVAL environment variable
+	// is used, if valid, and no summaries are logged otherwise.
+	healthInterval time.Duration
+	// fallbackFormat is the format of entries written to stderr, if they
+	// can't be sent or remote logging is disabled. If unset, the
+	// BEAM_LOG_FALLBACK_FORMAT environment variable is used, if valid,
+	// falling back to fallbackPlain.
+	fallbackFormat fallbackFormat
+	// dedupWindow, if positive, enables the deduplication of messages: a
+	// message logged again with the same severity within the window after
+	// it was first logged isn't sent. Instead, a single entry with the
+	// number of repeats, and the location and references of the message,
+	// is sent once the window closes, or once a different message is
+	// logged, whichever comes first. If unset, the
+	// BEAM_LOG_DEDUP_WINDOW environment variable is used, if valid.
+	dedupWindow time.Duration
+	// siteRate, if positive, is the number of messages per second that are
+	// logged from each call site, as given by its file and line. Messages
+	// beyond it are dropped, so that a hot log statement can't crowd out
+	// the others. It has no effect if omitLocation is set. If unset, the
+	// BEAM_LOG_SITE_RATE environment variable is used, and otherwise the
+	// rate is unlimited.
+	siteRate int
+	// omitLocation leaves out the file:line location of entries, saving a
+	// runtime.Caller lookup per entry. It is also set if the
+	// BEAM_LOG_OMIT_LOCATION environment variable is true.
+	omitLocation bool
+	// fullLocation keeps the full path of the file in the location of
+	// entries, rather than only its last two elements. It is also set if the
+	// BEAM_LOG_FULL_LOCATION environment variable is true.
+	fullLocation bool
+	// recorderSize is the number of recent entries that aren't sent, such
+	// as those below level, kept in memory to be sent as context ahead of
+	// the entry of a panic or fatal error. If unset, the
+	// BEAM_LOG_RECORDER_SIZE environment variable is used, falling back to
+	// defaultRecorderSize, which disables the recorder, as does a negative
+	// size.
+	recorderSize int
+	// recorderLevel is the minimum severity of the entries kept. Messages
+	// are formatted down to this severity, even if they aren't logged, and
+	// log.Enabled reports it as enabled. If unset, the
+	// BEAM_LOG_RECORDER_LEVEL environment variable is used, falling back to
+	// defaultRecorderLevel.
+	recorderLevel log.Severity
+	// batchSize is the maximum number of entries sent in a single
+	// LogEntry_List. A batch is sent as soon as it is full, or once
+	// flushInterval elapses, whichever comes first. If unset, the
+	// BEAM_LOG_BATCH_SIZE environment variable is used, falling back to
+	// defaultBatchSize.
+	batchSize int
+	// flushInterval is the maximum time a partial batch is held before it is
+	// sent, which bounds the latency of entries when little is logged. A
+	// longer interval makes for fewer, larger batches. If unset, the
+	// BEAM_LOG_FLUSH_INTERVAL environment variable is used, if valid,
+	// falling back to defaultFlushInterval.
+	flushInterval time.Duration
+	// eventTime stamps entries with the event time of the element being
+	// processed, as set in their context with log.WithEventTime, rather
+	// than the time they are logged, so that they line up with the timeline
+	// of the data when debugging a streaming pipeline. Entries without an
+	// event time are stamped as usual. It is also set if the
+	// BEAM_LOG_EVENT_TIME environment variable is true.
+	eventTime bool
+	// fatalFlushTimeout bounds how long a fatal entry, such as that of a
+	// panic recovered by Main, waits to be sent before it is written to
+	// stderr instead, and the logging call returns. It is separate from the
+	// graceful drain on shutdown, which waits for all the buffered entries:
+	// on a panic, Main first waits for the fatal entry, for at most this
+	// long, and then drains the rest as it returns, bounded by
+	// shutdownDrainTimeout. If unset, the BEAM_LOG_FATAL_FLUSH_TIMEOUT
+	// environment variable is used, falling back to
+	// defaultFatalFlushTimeout.
+	fatalFlushTimeout time.Duration
+	// synchronous makes logging calls return only once the entry is sent,
+	// or syncFlushTimeout elapses, so that a short-lived program doesn't
+	// lose its last entries when it exits. It trades throughput for
+	// reliability, since each call waits for a round trip to the runner. It
+	// is also set if the BEAM_LOG_SYNCHRONOUS environment variable is true.
+	synchronous bool
+	// keepalive configures the pings on the FnLogging connection, which keep
+	// an idle connection from being dropped by proxies, and detect a dead
+	// one before the next send. If its Time is unset, the
+	// BEAM_LOG_KEEPALIVE_TIME and BEAM_LOG_KEEPALIVE_TIMEOUT environment
+	// variables are used, if valid, falling back to defaultKeepaliveTime and
+	// defaultKeepaliveTimeout. PermitWithoutStream is also set if the
+	// BEAM_LOG_KEEPALIVE_PERMIT_WITHOUT_STREAM environment variable is true.
+	// A negative Time disables the pings. They are skipped, which is
+	// reported to stderr, if grpcx.Dial was customized without
+	// grpcx.DialWithOptions.
+	keepalive keepalive.ClientParameters
+	// compress enables gzip compression of the FnLogging stream. Log
+	// entries are repetitive, so this typically shrinks the traffic several
+	// times over, at the cost of CPU time on the worker and the runner. It
+	// is also set if the BEAM_LOG_COMPRESS environment variable is true.
+	compress bool
+	// dialTimeout bounds each attempt to connect to the endpoint, after
+	// which the connection is retried with backoff. A short timeout
+	// surfaces an unreachable endpoint sooner, while a slow environment may
+	// need a longer one. If unset, the BEAM_LOG_DIAL_TIMEOUT environment
+	// variable is used, if valid, falling back to defaultDialTimeout.
+	dialTimeout time.Duration
+	// maxBatchBytes is the maximum serialized size of each LogEntry_List
+	// sent, beyond which a batch is split, so that it stays under the gRPC
+	// message size limit of the runner. An entry that exceeds it by itself
+	// is sent alone. If unset, the BEAM_LOG_MAX_BATCH_BYTES environment
+	// variable is used, falling back to defaultMaxBatchBytes.
+	maxBatchBytes int
+	// maxRetries, if positive, is the number of consecutive attempts to
+	// reconnect to the endpoint after which the writer gives up, with a
+	// warning, and writes the entries to stderr instead. This keeps a
+	// short-lived program with an unreachable endpoint from retrying
+	// forever. If unset, the BEAM_LOG_MAX_RETRIES environment variable is
+	// used, and otherwise the writer retries indefinitely.
+	maxRetries int
+	// sendTimeout bounds each send on the FnLogging stream. A send that
+	// takes longer aborts the stream, which is then reconnected, and the
+	// batch is retried. If unset, the BEAM_LOG_SEND_TIMEOUT environment
+	// variable is used, falling back to defaultSendTimeout.
+	sendTimeout time.Duration
+	// omitMessageFields leaves out the fields identifying the worker, and
+	// the labels, from the messages, to which they are otherwise appended,
+	// as with log.WithFields, since LogEntry has no fields of its own. They
+	// are sent once per FnLogging stream regardless, as its gRPC metadata,
+	// with keys prefixed by streamMetadataPrefix. It is also set if the
+	// BEAM_LOG_OMIT_MESSAGE_FIELDS environment variable is true.
+	omitMessageFields bool
+	// fileDir, if set, is the directory to which the entries are also
+	// written, as by a Sink from NewFileSink with fileMaxBytes and
+	// fileMaxFiles, which are rotated in it. If unset, the
+	// BEAM_LOG_FILE_DIR, BEAM_LOG_FILE_MAX_BYTES and BEAM_LOG_FILE_MAX_FILES
+	// environment variables are used, and no file is written by default.
+	fileDir      string
+	fileMaxBytes int
+	fileMaxFiles int
+}
+
+// withDefaults returns the options with unset values taken from the
+// environment or set to their defaults. The environment variables are only
+// read here, so that each is parsed, and validated, in the same way.
+func (o Options) withDefaults() Options {
+	if o.bufferSize <= 0 {
+		o.bufferSize = envInt("BEAM_LOG_BUFFER_SIZE", defaultBufferSize)
+	}
+	if o.recorderSize == 0 {
+		o.recorderSize = envInt("BEAM_LOG_RECORDER_SIZE", defaultRecorderSize)
+	}
+	if o.recorderLevel == log.SevUnspecified {
+		o.recorderLevel = envSeverity("BEAM_LOG_RECORDER_LEVEL", defaultRecorderLevel)
+	}
+	if o.bufferBytes <= 0 {
+		o.bufferBytes = envInt("BEAM_LOG_BUFFER_BYTES", defaultBufferBytes)
+	}
+	if o.maxMessageSize <= 0 {
+		o.maxMessageSize = envInt("BEAM_LOG_MAX_MESSAGE_SIZE", defaultMaxMessageSize)
+	}
+	if o.traceLevel == log.SevUnspecified {
+		o.traceLevel = envSeverity("BEAM_LOG_TRACE_LEVEL", log.SevUnspecified)
+	}
+	if o.maxTraceSize <= 0 {
+		o.maxTraceSize = envInt("BEAM_LOG_MAX_TRACE_SIZE", defaultMaxTraceSize)
+	}
+	if o.ProvisionLabels == nil {
+		o.ProvisionLabels = parseProvisionLabels(os.Getenv("BEAM_LOG_PROVISION_LABELS"))
+		if o.ProvisionLabels == nil {
+			o.ProvisionLabels = defaultProvisionLabels
+		}
+	}
+	if o.dropPolicy == dropNewest {
+		o.dropPolicy, _ = parseDropPolicy(os.Getenv("BEAM_LOG_DROP_POLICY"))
+	}
+	if o.delivery == deliveryBestEffort {
+		o.delivery, _ = parseDeliveryMode(os.Getenv("BEAM_LOG_DELIVERY"))
+	}
+	if o.siteRate <= 0 {
+		o.siteRate = envInt("BEAM_LOG_SITE_RATE", 0)
+	}
+	if o.dedupWindow <= 0 {
+		o.dedupWindow = envDuration("BEAM_LOG_DEDUP_WINDOW", 0)
+	}
+	if o.batchSize <= 0 {
+		o.batchSize = envInt("BEAM_LOG_BATCH_SIZE", defaultBatchSize)
+	}
+	if o.flushInterval <= 0 {
+		o.flushInterval = envDuration("BEAM_LOG_FLUSH_INTERVAL", defaultFlushInterval)
+	}
+	if o.blockThreshold <= 0 {
+		o.blockThreshold = envFloat("BEAM_LOG_BLOCK_THRESHOLD", 0)
+	}
+	if o.blockTimeout <= 0 {
+		o.blockTimeout = envDuration("BEAM_LOG_BLOCK_TIMEOUT", defaultBlockTimeout)
+	}
+	if o.healthInterval <= 0 {
+		o.healthInterval = envDuration("BEAM_LOG_HEALTH_INTERVAL", 0)
+	}
+	if o.fallbackFormat == fallbackPlain {
+		o.fallbackFormat, _ = parseFallbackFormat(os.Getenv("BEAM_LOG_FALLBACK_FORMAT"))
+	}
+	if o.maxBatchBytes <= 0 {
+		o.maxBatchBytes = envInt("BEAM_LOG_MAX_BATCH_BYTES", defaultMaxBatchBytes)
+	}
+	if o.fileDir == "" {
+		o.fileDir = os.Getenv("BEAM_LOG_FILE_DIR")
+	}
+	if o.fileMaxBytes <= 0 {
+		o.fileMaxBytes = envInt("BEAM_LOG_FILE_MAX_BYTES", defaultLogFileMaxBytes)
+	}
+	if o.fileMaxFiles <= 0 {
+		o.fileMaxFiles = envInt("BEAM_LOG_FILE_MAX_FILES", defaultLogFileMaxFiles)
+	}
+	if o.maxRetries <= 0 {
+		o.maxRetries = envInt("BEAM_LOG_MAX_RETRIES", 0)
+	}
+	if o.dialTimeout <= 0 {
+		o.dialTimeout = envDuration("BEAM_LOG_DIAL_TIMEOUT", defaultDialTimeout)
+	}
+	if o.fatalFlushTimeout <= 0 {
+		o.fatalFlushTimeout = envDuration("BEAM_LOG_FATAL_FLUSH_TIMEOUT", defaultFatalFlushTimeout)
+	}
+	if o.sendTimeout <= 0 {
+		o.sendTimeout = envDuration("BEAM_LOG_SEND_TIMEOUT", defaultSendTimeout)
+	}
+	o.omitLocation = o.omitLocation || envBool("BEAM_LOG_OMIT_LOCATION")
+	o.fullLocation = o.fullLocation || envBool("BEAM_LOG_FULL_LOCATION")
+	o.eventTime = o.eventTime || envBool("BEAM_LOG_EVENT_TIME")
+	o.synchronous = o.synchronous || envBool("BEAM_LOG_SYNCHRONOUS")
+	o.compress = o.compress || envBool("BEAM_LOG_COMPRESS")
+	o.omitMessageFields = o.omitMessageFields || envBool("BEAM_LOG_OMIT_MESSAGE_FIELDS")
+	o.disabled = o.disabled || envBool("BEAM_DISABLE_REMOTE_LOGGING")
+	if o.keepalive.Time == 0 {
+		o.keepalive.Time = envDuration("BEAM_LOG_KEEPALIVE_TIME", defaultKeepaliveTime)
+		if o.keepalive.Timeout <= 0 {
+			o.keepalive.Timeout = envDuration("BEAM_LOG_KEEPALIVE_TIMEOUT", defaultKeepaliveTimeout)
+		}
+	}
+	o.keepalive.PermitWithoutStream = o.keepalive.PermitWithoutStream || envBool("BEAM_LOG_KEEPALIVE_PERMIT_WITHOUT_STREAM")
+	return o
+}
+
+// envInt returns the value of the environment variable, if it is a positive
+// integer, and def otherwise.
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// envFloat returns the value of the environment variable, if it is a positive
+// number, and def otherwise.
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// envDuration returns the value of the environment variable, if it is a
+// positive duration, such as "500ms", and def otherwise.
+func envDuration(name string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// envBool reports whether the environment variable is true, as parsed by
+// strconv.ParseBool.
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
+// envSeverity returns the severity named by the environment variable, if it
+// is valid, and def otherwise. See ParseLevel.
+func envSeverity(name string, def log.Severity) log.Severity {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	sev, err := ParseLevel(v)
+	if err != nil {
+		return def
+	}
+	return sev
+}
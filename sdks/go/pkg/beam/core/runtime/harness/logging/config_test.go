@@ -0,0 +1,200 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestCurrentConfig(t *testing.T) {
+	ctx := context.Background()
+	r := Start(ctx, "", Options{
+		Level:         log.SevWarn,
+		bufferSize:    10,
+		flushInterval: time.Minute,
+		Sink:          &collectSink{},
+		Sinks:         []Sink{&collectSink{}},
+	})
+	defer r.Close(ctx)
+
+	Mute()
+	log.Error(ctx, "suppressed")
+	c, ok := CurrentConfig()
+	Unmute()
+	if !ok {
+		t.Fatal("CurrentConfig() reported no remote logging")
+	}
+	want := Config{
+		Sink:          "*logging.collectSink",
+		Sinks:         1,
+		Level:         log.SevWarn,
+		BufferSize:    10,
+		BufferBytes:   defaultBufferBytes,
+		BatchSize:     defaultBatchSize,
+		MaxBatchBytes: defaultMaxBatchBytes,
+		FlushInterval: time.Minute,
+		Muted:         true,
+		Suppressed:    1,
+	}
+	if c != want {
+		t.Errorf("CurrentConfig() = %+v, want %+v", c, want)
+	}
+	for _, s := range []string{"level=WARN", "sink=*logging.collectSink", "muted=true", "suppressed=1"} {
+		if !strings.Contains(c.String(), s) {
+			t.Errorf("String() = %q, want it to contain %q", c.String(), s)
+		}
+	}
+}
+
+func TestLoggingConfigNotSetUp(t *testing.T) {
+	if _, ok := CurrentConfig(); ok {
+		t.Error("CurrentConfig() reported remote logging that isn't set up")
+	}
+}
+
+func TestLoggingOptionsBufferSize(t *testing.T) {
+	defer os.Unsetenv("BEAM_LOG_BUFFER_SIZE")
+
+	tests := []struct {
+		opt  int
+		env  string
+		want int
+	}{
+		{0, "", defaultBufferSize},
+		{0, "5000", 5000},
+		{0, "-1", defaultBufferSize},
+		{0, "lots", defaultBufferSize},
+		{10, "5000", 10},
+	}
+	for _, test := range tests {
+		os.Setenv("BEAM_LOG_BUFFER_SIZE", test.env)
+		if got := (Options{bufferSize: test.opt}).withDefaults().bufferSize; got != test.want {
+			t.Errorf("bufferSize for option %v, env %q = %v, want %v", test.opt, test.env, got, test.want)
+		}
+	}
+}
+
+func TestLoggingOptionsKeepalive(t *testing.T) {
+	tests := []struct {
+		opt  keepalive.ClientParameters
+		want keepalive.ClientParameters
+	}{
+		{keepalive.ClientParameters{}, keepalive.ClientParameters{Time: defaultKeepaliveTime, Timeout: defaultKeepaliveTimeout}},
+		{keepalive.ClientParameters{Timeout: time.Second}, keepalive.ClientParameters{Time: defaultKeepaliveTime, Timeout: time.Second}},
+		{keepalive.ClientParameters{Time: time.Minute, PermitWithoutStream: true}, keepalive.ClientParameters{Time: time.Minute, PermitWithoutStream: true}},
+		{keepalive.ClientParameters{Time: -1}, keepalive.ClientParameters{Time: -1}},
+	}
+	for _, test := range tests {
+		if got := (Options{keepalive: test.opt}).withDefaults().keepalive; got != test.want {
+			t.Errorf("keepalive for option %+v = %+v, want %+v", test.opt, got, test.want)
+		}
+	}
+}
+
+func TestLoggingOptionsFlushInterval(t *testing.T) {
+	defer os.Unsetenv("BEAM_LOG_FLUSH_INTERVAL")
+
+	tests := []struct {
+		opt  time.Duration
+		env  string
+		want time.Duration
+	}{
+		{0, "", defaultFlushInterval},
+		{0, "1s", time.Second},
+		{0, "-1s", defaultFlushInterval},
+		{0, "soon", defaultFlushInterval},
+		{time.Millisecond, "1s", time.Millisecond},
+	}
+	for _, test := range tests {
+		os.Setenv("BEAM_LOG_FLUSH_INTERVAL", test.env)
+		if got := (Options{flushInterval: test.opt}).withDefaults().flushInterval; got != test.want {
+			t.Errorf("flushInterval for option %v, env %q = %v, want %v", test.opt, test.env, got, test.want)
+		}
+	}
+}
+
+func TestLoggingOptionsEnv(t *testing.T) {
+	tests := []struct {
+		env   string
+		value string
+		get   func(Options) interface{}
+		want  interface{}
+	}{
+		{"BEAM_LOG_BUFFER_BYTES", "1024", func(o Options) interface{} { return o.bufferBytes }, 1024},
+		{"BEAM_LOG_BUFFER_BYTES", "0", func(o Options) interface{} { return o.bufferBytes }, defaultBufferBytes},
+		{"BEAM_LOG_MAX_MESSAGE_SIZE", "100", func(o Options) interface{} { return o.maxMessageSize }, 100},
+		{"BEAM_LOG_RECORDER_SIZE", "10", func(o Options) interface{} { return o.recorderSize }, 10},
+		{"BEAM_LOG_RECORDER_SIZE", "", func(o Options) interface{} { return o.recorderSize }, 0},
+		{"BEAM_LOG_RECORDER_LEVEL", "", func(o Options) interface{} { return o.recorderLevel }, log.SevDebug},
+		{"BEAM_LOG_RECORDER_LEVEL", "info", func(o Options) interface{} { return o.recorderLevel }, log.SevInfo},
+		{"BEAM_LOG_TRACE_LEVEL", "error", func(o Options) interface{} { return o.traceLevel }, log.SevError},
+		{"BEAM_LOG_TRACE_LEVEL", "loud", func(o Options) interface{} { return o.traceLevel }, log.SevUnspecified},
+		{"BEAM_LOG_MAX_TRACE_SIZE", "4096", func(o Options) interface{} { return o.maxTraceSize }, 4096},
+		{"BEAM_LOG_MAX_TRACE_SIZE", "-1", func(o Options) interface{} { return o.maxTraceSize }, defaultMaxTraceSize},
+		{"BEAM_LOG_DROP_POLICY", "oldest", func(o Options) interface{} { return o.dropPolicy }, dropOldest},
+		{"BEAM_LOG_DELIVERY", "at-least-once", func(o Options) interface{} { return o.delivery }, deliveryAtLeastOnce},
+		{"BEAM_LOG_SITE_RATE", "5", func(o Options) interface{} { return o.siteRate }, 5},
+		{"BEAM_LOG_DEDUP_WINDOW", "1s", func(o Options) interface{} { return o.dedupWindow }, time.Second},
+		{"BEAM_LOG_DEDUP_WINDOW", "-1s", func(o Options) interface{} { return o.dedupWindow }, time.Duration(0)},
+		{"BEAM_LOG_BLOCK_THRESHOLD", "0.9", func(o Options) interface{} { return o.blockThreshold }, 0.9},
+		{"BEAM_LOG_BLOCK_THRESHOLD", "most", func(o Options) interface{} { return o.blockThreshold }, 0.0},
+		{"BEAM_LOG_BLOCK_TIMEOUT", "1s", func(o Options) interface{} { return o.blockTimeout }, time.Second},
+		{"BEAM_LOG_BLOCK_TIMEOUT", "", func(o Options) interface{} { return o.blockTimeout }, defaultBlockTimeout},
+		{"BEAM_LOG_HEALTH_INTERVAL", "1m", func(o Options) interface{} { return o.healthInterval }, time.Minute},
+		{"BEAM_LOG_FALLBACK_FORMAT", "json", func(o Options) interface{} { return o.fallbackFormat }, fallbackJSON},
+		{"BEAM_LOG_BATCH_SIZE", "10", func(o Options) interface{} { return o.batchSize }, 10},
+		{"BEAM_LOG_BATCH_SIZE", "none", func(o Options) interface{} { return o.batchSize }, defaultBatchSize},
+		{"BEAM_LOG_MAX_BATCH_BYTES", "2048", func(o Options) interface{} { return o.maxBatchBytes }, 2048},
+		{"BEAM_LOG_FILE_DIR", "/tmp/logs", func(o Options) interface{} { return o.fileDir }, "/tmp/logs"},
+		{"BEAM_LOG_FILE_MAX_BYTES", "4096", func(o Options) interface{} { return o.fileMaxBytes }, 4096},
+		{"BEAM_LOG_FILE_MAX_FILES", "3", func(o Options) interface{} { return o.fileMaxFiles }, 3},
+		{"BEAM_LOG_SEND_TIMEOUT", "2s", func(o Options) interface{} { return o.sendTimeout }, 2 * time.Second},
+		{"BEAM_LOG_SEND_TIMEOUT", "soon", func(o Options) interface{} { return o.sendTimeout }, defaultSendTimeout},
+		{"BEAM_LOG_DIAL_TIMEOUT", "30s", func(o Options) interface{} { return o.dialTimeout }, 30 * time.Second},
+		{"BEAM_LOG_DIAL_TIMEOUT", "0", func(o Options) interface{} { return o.dialTimeout }, defaultDialTimeout},
+		{"BEAM_LOG_KEEPALIVE_TIME", "1m", func(o Options) interface{} { return o.keepalive.Time }, time.Minute},
+		{"BEAM_LOG_KEEPALIVE_TIME", "-1s", func(o Options) interface{} { return o.keepalive.Time }, defaultKeepaliveTime},
+		{"BEAM_LOG_KEEPALIVE_TIMEOUT", "5s", func(o Options) interface{} { return o.keepalive.Timeout }, 5 * time.Second},
+		{"BEAM_LOG_KEEPALIVE_TIMEOUT", "later", func(o Options) interface{} { return o.keepalive.Timeout }, defaultKeepaliveTimeout},
+		{"BEAM_LOG_KEEPALIVE_PERMIT_WITHOUT_STREAM", "true", func(o Options) interface{} { return o.keepalive.PermitWithoutStream }, true},
+		{"BEAM_LOG_MAX_RETRIES", "2", func(o Options) interface{} { return o.maxRetries }, 2},
+		{"BEAM_LOG_FATAL_FLUSH_TIMEOUT", "1s", func(o Options) interface{} { return o.fatalFlushTimeout }, time.Second},
+		{"BEAM_LOG_FATAL_FLUSH_TIMEOUT", "never", func(o Options) interface{} { return o.fatalFlushTimeout }, defaultFatalFlushTimeout},
+		{"BEAM_LOG_PROVISION_LABELS", "job_id", func(o Options) interface{} { return strings.Join(o.ProvisionLabels, ",") }, "job_id"},
+		{"BEAM_LOG_PROVISION_LABELS", "", func(o Options) interface{} { return strings.Join(o.ProvisionLabels, ",") }, strings.Join(defaultProvisionLabels, ",")},
+		{"BEAM_LOG_OMIT_LOCATION", "true", func(o Options) interface{} { return o.omitLocation }, true},
+		{"BEAM_LOG_FULL_LOCATION", "1", func(o Options) interface{} { return o.fullLocation }, true},
+		{"BEAM_LOG_EVENT_TIME", "true", func(o Options) interface{} { return o.eventTime }, true},
+		{"BEAM_LOG_SYNCHRONOUS", "true", func(o Options) interface{} { return o.synchronous }, true},
+		{"BEAM_LOG_COMPRESS", "yes", func(o Options) interface{} { return o.compress }, false},
+		{"BEAM_LOG_OMIT_MESSAGE_FIELDS", "true", func(o Options) interface{} { return o.omitMessageFields }, true},
+	}
+	for _, test := range tests {
+		os.Setenv(test.env, test.value)
+		got := test.get(Options{}.withDefaults())
+		os.Unsetenv(test.env)
+		if got != test.want {
+			t.Errorf("option for %v=%q = %v, want %v", test.env, test.value, got, test.want)
+		}
+	}
+}
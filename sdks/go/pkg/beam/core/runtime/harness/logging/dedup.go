@@ -0,0 +1,159 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// maxDedupKeys bounds the number of distinct messages tracked by a deduper.
+// Messages beyond it are logged as is.
+const maxDedupKeys = 1000
+
+type dedupKey struct {
+	sev log.Severity
+	msg string
+}
+
+// dedupOrigin is the location and references of the entry of a message when
+// it was first logged in its window, which the report of its repeats carries.
+type dedupOrigin struct {
+	location, instruction, transform, thread string
+}
+
+type dedupState struct {
+	// until is when the window of the message closes.
+	until time.Time
+	// count is the number of repeats suppressed in the window so far, the
+	// last of which was at last.
+	count  int
+	last   time.Time
+	origin dedupOrigin
+}
+
+// repeat is a message that was suppressed count times, the last time at last.
+type repeat struct {
+	dedupKey
+	count  int
+	last   time.Time
+	origin dedupOrigin
+}
+
+// String returns the message annotated with its number of repeats.
+func (r repeat) String() string {
+	return fmt.Sprintf("%v (repeated %v times)", r.msg, r.count)
+}
+
+// entry returns the entry reporting the repeats, with the given severity.
+func (r repeat) entry(sev pb.LogEntry_Severity_Enum) *pb.LogEntry {
+	entry := newEntry(r.last, sev, r.String())
+	entry.LogLocation = r.origin.location
+	entry.InstructionReference = r.origin.instruction
+	entry.PrimitiveTransformReference = r.origin.transform
+	entry.Thread = r.origin.thread
+	return entry
+}
+
+// deduper coalesces repeats of a message of the same severity within a window
+// after the message is first logged. The repeats are reported as a single
+// entry once the window closes, or once a different message is logged.
+type deduper struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[dedupKey]*dedupState
+	lastSweep time.Time
+	// last is the message logged or suppressed last.
+	last dedupKey
+}
+
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{window: window, seen: make(map[dedupKey]*dedupState)}
+}
+
+// suppress returns whether the message of the entry is a repeat within its
+// window, in which case it is counted rather than logged. If the message
+// differs from the one logged last, the repeats of that one are returned, to
+// be reported ahead of the entry, and its window is closed.
+func (d *deduper) suppress(now time.Time, sev log.Severity, entry *pb.LogEntry) (bool, []repeat) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := dedupKey{sev, entry.GetMessage()}
+	var ret []repeat
+	if k != d.last {
+		if s, ok := d.seen[d.last]; ok && s.count > 0 {
+			ret = append(ret, repeat{d.last, s.count, s.last, s.origin})
+			delete(d.seen, d.last)
+		}
+		d.last = k
+	}
+	if s, ok := d.seen[k]; ok && now.Before(s.until) {
+		s.count++
+		s.last = now
+		return true, ret
+	}
+	if len(d.seen) < maxDedupKeys {
+		d.seen[k] = &dedupState{
+			until: now.Add(d.window),
+			origin: dedupOrigin{
+				location:    entry.GetLogLocation(),
+				instruction: entry.GetInstructionReference(),
+				transform:   entry.GetPrimitiveTransformReference(),
+				thread:      entry.GetThread(),
+			},
+		}
+	}
+	return false, ret
+}
+
+// expire returns the repeats of messages whose window has closed, if any, and
+// stops tracking those messages. Windows are swept at most once per window,
+// unless all is set, which expires all windows.
+func (d *deduper) expire(now time.Time, all bool) []repeat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !all && now.Sub(d.lastSweep) < d.window {
+		return nil
+	}
+	d.lastSweep = now
+
+	var ret []repeat
+	for k, s := range d.seen {
+		if !all && now.Before(s.until) {
+			continue
+		}
+		if s.count > 0 {
+			ret = append(ret, repeat{k, s.count, s.last, s.origin})
+		}
+		delete(d.seen, k)
+	}
+	return ret
+}
+
+// sweepRepeats reports the repeats of the messages whose window has closed.
+// The writer calls it on each tick of its flush ticker, so that the repeats
+// of a burst followed by silence aren't held back until the next entry.
+func (l *logger) sweepRepeats(ctx context.Context) {
+	l.writeRepeats(ctx, l.dedup.expire(l.timeNow(), false))
+}
@@ -0,0 +1,135 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogDedup(t *testing.T) {
+	now := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	buf := make(chan *pb.LogEntry, 10)
+	l := &logger{
+		out:          buf,
+		stats:        &logStats{},
+		omitLocation: true,
+		now:          func() time.Time { return now },
+		dedup:        newDeduper(time.Second),
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		l.Log(ctx, log.SevInfo, 0, "repeated")
+	}
+	l.Log(ctx, log.SevWarn, 0, "repeated") // differs in severity
+	l.Log(ctx, log.SevWarn, 0, "repeated")
+	now = now.Add(2 * time.Second) // closes the window
+	l.Log(ctx, log.SevInfo, 0, "repeated")
+
+	var got []string
+	for len(buf) > 0 {
+		got = append(got, (<-buf).GetMessage())
+	}
+	// The repeats are reported once a different message is logged, or once
+	// the window closes.
+	want := []string{"repeated", "repeated (repeated 2 times)", "repeated", "repeated (repeated 1 times)", "repeated"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestDeduperBounded(t *testing.T) {
+	now := time.Now()
+	d := newDeduper(time.Minute)
+	for i := 0; i < maxDedupKeys+10; i++ {
+		d.suppress(now, log.SevInfo, newEntry(now, pb.LogEntry_Severity_INFO, fmt.Sprint(i)))
+	}
+	if got := len(d.seen); got != maxDedupKeys {
+		t.Errorf("tracked %v messages, want %v", got, maxDedupKeys)
+	}
+	// Untracked messages aren't suppressed.
+	if ok, _ := d.suppress(now, log.SevInfo, newEntry(now, pb.LogEntry_Severity_INFO, fmt.Sprint(maxDedupKeys+1))); ok {
+		t.Errorf("suppressed an untracked message")
+	}
+}
+
+func TestLogDedupOrigin(t *testing.T) {
+	now := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	buf := make(chan *pb.LogEntry, 10)
+	l := &logger{
+		out:   buf,
+		stats: &logStats{},
+		now:   func() time.Time { return now },
+		dedup: newDeduper(time.Second),
+	}
+
+	ctx := WithThreadID(log.WithInstructionID(context.Background(), "inst"), "bundle-1")
+	for i := 0; i < 3; i++ {
+		l.Log(ctx, log.SevInfo, 0, "repeated")
+	}
+	l.Log(ctx, log.SevInfo, 0, "different")
+
+	first := <-buf
+	summary := <-buf
+	if got, want := summary.GetMessage(), "repeated (repeated 2 times)"; got != want {
+		t.Fatalf("second entry = %q, want %q", got, want)
+	}
+	if summary.GetLogLocation() == "" || summary.GetLogLocation() != first.GetLogLocation() {
+		t.Errorf("location of the summary = %q, want %q", summary.GetLogLocation(), first.GetLogLocation())
+	}
+	if got := summary.GetInstructionReference(); got != "inst" {
+		t.Errorf("instruction of the summary = %q, want %q", got, "inst")
+	}
+	if got := summary.GetThread(); got != "bundle-1" {
+		t.Errorf("thread of the summary = %q, want %q", got, "bundle-1")
+	}
+}
+
+func TestLogDedupSweep(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, dedupWindow: 10 * time.Millisecond, flushInterval: 5 * time.Millisecond})
+	defer r.Close(ctx)
+
+	// The repeats of a burst followed by silence are reported once the
+	// window closes, without another entry or a flush.
+	for i := 0; i < 3; i++ {
+		log.Info(ctx, "burst")
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sink.mu.Lock()
+		var got []string
+		for _, e := range sink.entries {
+			got = append(got, e.GetMessage())
+		}
+		sink.mu.Unlock()
+		if fmt.Sprint(got) == fmt.Sprint([]string{"burst", "burst (repeated 2 times)"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sink received %q, want the entry and a summary of its repeats", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
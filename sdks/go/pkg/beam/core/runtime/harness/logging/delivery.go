@@ -0,0 +1,87 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// deliveryMode determines what happens to the entries sent on a stream that
+// then fails.
+type deliveryMode int
+
+const (
+	// deliveryBestEffort considers entries delivered once they are sent.
+	// Those still in transit when the stream fails are lost, as are the
+	// batches that repeatedly fail to be sent.
+	deliveryBestEffort deliveryMode = iota
+	// deliveryAtLeastOnce holds the entries sent on a stream in flight, and
+	// sends them again on the next stream if it fails, along with the
+	// batches that failed to be sent, however often, so that no entry is
+	// lost in between, at the cost of possible duplicates.
+	deliveryAtLeastOnce
+)
+
+// parseDeliveryMode returns the delivery mode with the given name,
+// "best-effort" or "at-least-once".
+func parseDeliveryMode(name string) (deliveryMode, error) {
+	switch strings.ToLower(name) {
+	case "best-effort":
+		return deliveryBestEffort, nil
+	case "at-least-once":
+		return deliveryAtLeastOnce, nil
+	default:
+		return deliveryBestEffort, fmt.Errorf("invalid delivery mode %q", name)
+	}
+}
+
+// maxInFlight bounds the entries held in flight. The FnLogging service doesn't
+// acknowledge entries, so those sent on a stream are held until it ends, and
+// the oldest are considered delivered once more than maxInFlight were sent
+// since, as the stream would have failed in the meantime otherwise.
+const maxInFlight = defaultBufferSize
+
+// hold keeps the entries sent on the current stream in flight, if delivery is
+// at least once.
+func (w *remoteWriter) hold(batch []*pb.LogEntry) {
+	if !w.atLeastOnce || w.cancelStream == nil {
+		return
+	}
+	w.inFlight = append(w.inFlight, batch...)
+	if n := len(w.inFlight) - maxInFlight; n > 0 {
+		w.inFlight = append(w.inFlight[:0], w.inFlight[n:]...)
+	}
+}
+
+// requeue sends the entries in flight again, ahead of the pending ones, once
+// the stream they were sent on failed with err. The entries are considered
+// delivered if the stream ended cleanly instead, as the runner closed it or
+// ctx was cancelled, which would only duplicate them.
+func (w *remoteWriter) requeue(ctx context.Context, err error) {
+	if err == errStreamClosed || ctx.Err() != nil {
+		w.inFlight = nil
+		return
+	}
+	if len(w.inFlight) == 0 {
+		return
+	}
+	w.pending = append(w.inFlight, w.pending...)
+	w.inFlight = nil
+}
@@ -0,0 +1,145 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestParseDeliveryMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    deliveryMode
+		wantErr bool
+	}{
+		{"best-effort", deliveryBestEffort, false},
+		{"At-Least-Once", deliveryAtLeastOnce, false},
+		{"", deliveryBestEffort, true},
+		{"exactly-once", deliveryBestEffort, true},
+	}
+	for _, test := range tests {
+		got, err := parseDeliveryMode(test.name)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("parseDeliveryMode(%q) = %v, %v, want %v, error %v", test.name, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestRemoteWriterHold(t *testing.T) {
+	w := &remoteWriter{atLeastOnce: true, cancelStream: func() {}}
+	var batch []*pb.LogEntry
+	for i := 0; i < maxInFlight+10; i++ {
+		batch = append(batch, newEntry(time.Now(), pb.LogEntry_Severity_INFO, fmt.Sprintf("sent %v", i)))
+	}
+	w.hold(batch[:10])
+	w.hold(batch[10:])
+
+	// Only the most recent entries are held.
+	if len(w.inFlight) != maxInFlight || w.inFlight[0] != batch[10] {
+		t.Fatalf("held %v entries from %v, want %v from %v", len(w.inFlight), w.inFlight[0].GetMessage(), maxInFlight, batch[10].GetMessage())
+	}
+
+	pending := newEntry(time.Now(), pb.LogEntry_Severity_INFO, "pending")
+	w.pending = []*pb.LogEntry{pending}
+	w.requeue(context.Background(), fmt.Errorf("stream broken"))
+	if len(w.pending) != maxInFlight+1 || w.pending[0] != batch[10] || w.pending[maxInFlight] != pending {
+		t.Errorf("requeue() left %v pending entries, want those in flight ahead of the pending one", len(w.pending))
+	}
+	if len(w.inFlight) != 0 {
+		t.Errorf("requeue() left %v entries in flight, want none", len(w.inFlight))
+	}
+}
+
+func TestRemoteWriterRequeueCleanEnd(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{"closed by the runner", context.Background(), errStreamClosed},
+		{"cancelled", cancelled, context.Canceled},
+	}
+	for _, test := range tests {
+		w := &remoteWriter{atLeastOnce: true, cancelStream: func() {}}
+		w.hold([]*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "sent")})
+		w.requeue(test.ctx, test.err)
+		if len(w.pending) != 0 || len(w.inFlight) != 0 {
+			t.Errorf("requeue() once %v left %v pending and %v in flight, want none", test.name, len(w.pending), len(w.inFlight))
+		}
+	}
+}
+
+func TestRemoteWriterHoldBestEffort(t *testing.T) {
+	w := &remoteWriter{cancelStream: func() {}}
+	w.hold([]*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "sent")})
+	if len(w.inFlight) != 0 {
+		t.Errorf("held %v entries, want none with best effort delivery", len(w.inFlight))
+	}
+}
+
+func TestRemoteWriterRetryAtLeastOnce(t *testing.T) {
+	w := &remoteWriter{stats: &logStats{}, atLeastOnce: true}
+	batch := []*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "failing")}
+	for i := 0; i < 2*maxSendAttempts; i++ {
+		w.retry(batch)
+	}
+	if len(w.pending) != 1 || w.stats.dropped != 0 {
+		t.Errorf("retry() left %v pending entries, dropped %v, want the batch kept", len(w.pending), w.stats.dropped)
+	}
+}
+
+func TestRemoteLoggingAtLeastOnce(t *testing.T) {
+	tests := []struct {
+		delivery deliveryMode
+		want     int
+	}{
+		{deliveryBestEffort, 0},
+		{deliveryAtLeastOnce, 1},
+	}
+	for _, test := range tests {
+		srv, endpoint, stop := startFakeLoggingServer(t)
+		srv.loseStreams = 1
+
+		ctx := context.Background()
+		r := Start(ctx, endpoint, Options{delivery: test.delivery, flushInterval: time.Millisecond, FallbackWriter: &syncBuffer{}})
+
+		// The first list is sent, but lost with the stream, which the
+		// writer only notices on a later send.
+		log.Info(ctx, "in transit")
+		deadline := time.Now().Add(10 * time.Second)
+		for i := 0; len(srv.Entries("after")) == 0; i++ {
+			if time.Now().After(deadline) {
+				t.Fatalf("delivery %v: no entries received after the stream failed", test.delivery)
+			}
+			log.Infof(ctx, "after the stream failed %v", i)
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if got := len(srv.WaitForEntries(t, "in transit", test.want)); got != test.want {
+			t.Errorf("delivery %v: received %v entries lost in transit, want %v", test.delivery, got, test.want)
+		}
+		r.Close(ctx)
+		stop()
+	}
+}
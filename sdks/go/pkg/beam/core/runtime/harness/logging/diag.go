@@ -0,0 +1,63 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// LastError returns the last failure of the remote logging since entries
+// were last written successfully to the runner, or the sink, if any. It
+// returns nil if remote logging isn't set up.
+func LastError() error {
+	if l, ok := log.GetLogger().(*logger); ok {
+		return l.LastError()
+	}
+	return nil
+}
+
+// LastError returns the last failure of the writer since it last connected,
+// if any.
+func (l *logger) LastError() error {
+	return l.stats.lastError()
+}
+
+// errorHolder holds an error, possibly nil, in an atomic.Value, which requires
+// values of a consistent concrete type.
+type errorHolder struct {
+	err error
+}
+
+func (s *logStats) setError(err error) {
+	s.lastErr.Store(errorHolder{err})
+}
+
+func (s *logStats) lastError() error {
+	h, _ := s.lastErr.Load().(errorHolder)
+	return h.err
+}
+
+// observe records the failure as the last error of the writer, and sends it
+// to the diagnostics channel, if any, unless it is full.
+func (w *remoteWriter) observe(err error) {
+	w.stats.setError(err)
+	if w.diagnostics != nil {
+		select {
+		case w.diagnostics <- err:
+		default:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLoggingDiagnostics(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	diagnostics := make(chan error, 1)
+	ctx := context.Background()
+	opts := Options{dialTimeout: 50 * time.Millisecond, Diagnostics: diagnostics}
+	r := startLogging(ctx, addr, nil, opts.withDefaults())
+	defer func() {
+		r.cancel()
+		<-r.Done()
+	}()
+	if err := r.LastError(); err != nil {
+		t.Errorf("LastError() before the first failure = %v, want nil", err)
+	}
+
+	select {
+	case err := <-diagnostics:
+		if got := r.LastError(); got != err {
+			t.Errorf("LastError() = %v, want %v", got, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no failure sent to the diagnostics channel")
+	}
+}
+
+func TestLastError(t *testing.T) {
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: &collectSink{}})
+	if err := LastError(); err != nil {
+		t.Errorf("LastError() = %v, want nil", err)
+	}
+	failure := errors.New("failure")
+	r.stats.setError(failure)
+	if err := LastError(); err != failure {
+		t.Errorf("LastError() = %v, want %v", err, failure)
+	}
+
+	r.Close(ctx)
+	if err := LastError(); err != nil {
+		t.Errorf("LastError() once remote logging is closed = %v, want nil", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// disabledLogging installs log.Discard and returns a handle without a writer,
+// which restores prev when closed. Its logger has no buffers, so a panic
+// recovered by FlushOnPanic is only written to stderr.
+func disabledLogging(prev log.Logger) *Remote {
+	done := make(chan struct{})
+	close(done)
+	r := &Remote{
+		logger:   &logger{stats: &logStats{}},
+		prev:     prev,
+		cancel:   func() {},
+		done:     done,
+		disabled: true,
+	}
+	log.SetLogger(log.Discard)
+	return r
+}
@@ -0,0 +1,75 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+func TestLoggingDisabled(t *testing.T) {
+	sink := &collectSink{}
+	prev := log.GetLogger()
+
+	dir, err := ioutil.TempDir("", "logdisable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	r := Start(ctx, "localhost:1", Options{Sink: sink, fileDir: dir, disabled: true})
+	if got := log.GetLogger(); got != log.Discard {
+		t.Errorf("installed logger %T, want log.Discard", got)
+	}
+	select {
+	case <-r.Done():
+	default:
+		t.Error("Done() is open, want no writer")
+	}
+	log.Error(ctx, "discarded")
+	if err := r.Drain(ctx); err != nil {
+		t.Errorf("Drain failed: %v", err)
+	}
+	if len(sink.entries) != 0 {
+		t.Errorf("sink received %v, want nothing", sink.entries)
+	}
+	if got := log.GetLogger(); got != prev {
+		t.Errorf("logger after Drain = %T, want the previous one", got)
+	}
+}
+
+func TestLoggingOptionsDisabled(t *testing.T) {
+	defer os.Unsetenv("BEAM_DISABLE_REMOTE_LOGGING")
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		{"", false},
+		{"true", true},
+		{"1", true},
+		{"no", false},
+	}
+	for _, test := range tests {
+		os.Setenv("BEAM_DISABLE_REMOTE_LOGGING", test.env)
+		if got := (Options{}).withDefaults().disabled; got != test.want {
+			t.Errorf("disabled for env %q = %v, want %v", test.env, got, test.want)
+		}
+	}
+}
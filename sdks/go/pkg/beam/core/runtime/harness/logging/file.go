@@ -0,0 +1,169 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+const (
+	// logFileName is the name of the file written by a file sink in its
+	// directory. Rotated files get a numeric suffix, .1 being the newest.
+	logFileName = "harness.log"
+	// defaultLogFileMaxBytes is the size of a log file beyond which it is
+	// rotated.
+	defaultLogFileMaxBytes = 10 << 20
+	// defaultLogFileMaxFiles is the number of log files kept, including the
+	// current one.
+	defaultLogFileMaxFiles = 3
+)
+
+// fileSink is a Sink that writes entries to a file, as JSON lines, rotating
+// it once it exceeds maxBytes, and keeping at most maxFiles files.
+type fileSink struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	f    *os.File
+	size int64
+	buf  bytes.Buffer
+}
+
+// NewFileSink returns a Sink that writes the log entries to the file
+// harness.log in dir, one JSON object per line, such as to keep a copy on the
+// worker for post-mortem debugging, as one of Options.Sinks. Once the file
+// exceeds maxBytes, it is renamed harness.log.1, the previous harness.log.1
+// becomes harness.log.2, and so on, keeping at most maxFiles files in all. If
+// either is unset, 10MB and 3 files are used. The directory is created if
+// needed, and the file is appended to if it exists. The sink implements
+// io.Closer, which the harness calls once the entries are drained.
+func NewFileSink(dir string, maxBytes int64, maxFiles int) (Sink, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultLogFileMaxBytes
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultLogFileMaxFiles
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	s := &fileSink{path: filepath.Join(dir, logFileName), maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	s.f, s.size = f, fi.Size()
+	return nil
+}
+
+// Send writes the entries to the file, in a single write unless the file is
+// rotated in between.
+func (s *fileSink) Send(list *pb.LogEntry_List) error {
+	if s.f == nil {
+		// A rotation failed, or the sink was closed.
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	s.buf.Reset()
+	for _, e := range list.GetLogEntries() {
+		line := formatJSON(e) + "\n"
+		if n := s.size + int64(s.buf.Len()); n > 0 && n+int64(len(line)) > s.maxBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		s.buf.WriteString(line)
+	}
+	return s.flush()
+}
+
+// flush writes the buffered lines to the file.
+func (s *fileSink) flush() error {
+	n, err := s.f.Write(s.buf.Bytes())
+	s.size += int64(n)
+	s.buf.Reset()
+	return err
+}
+
+// rotate writes the buffered lines, and shifts the files by one, dropping
+// the oldest, so that a new file is written.
+func (s *fileSink) rotate() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+	for i := s.maxFiles - 1; i > 0; i-- {
+		from := s.path
+		if i > 1 {
+			from = fmt.Sprintf("%v.%d", s.path, i-1)
+		}
+		if err := os.Rename(from, fmt.Sprintf("%v.%d", s.path, i)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	}
+	if s.maxFiles == 1 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	}
+	return s.open()
+}
+
+// Close syncs and closes the file.
+func (s *fileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	return err
+}
+
+// closeSink closes the sink, if it implements io.Closer, once the writer has
+// stopped.
+func (w *remoteWriter) closeSink(sink Sink) {
+	if c, ok := sink.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			fmt.Fprintf(w.fallback(), "Failed to close log sink: %v\n", err)
+		}
+	}
+}
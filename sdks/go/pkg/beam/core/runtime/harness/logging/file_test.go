@@ -0,0 +1,113 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// readLogFile returns the messages of the JSON lines in the file, or nil if
+// it doesn't exist.
+func readLogFile(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("failed to read %v: %v", path, err)
+	}
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		var e jsonEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid line %q in %v: %v", line, path, err)
+		}
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+func TestFileLogSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	line := int64(len(formatJSON(newEntry(time.Unix(0, 0), pb.LogEntry_Severity_INFO, "msg0"))) + 1)
+	sink, err := NewFileSink(filepath.Join(dir, "logs"), 2*line, 3)
+	if err != nil {
+		t.Fatalf("NewFileSink failed: %v", err)
+	}
+	// Seven entries of the same size fill four files, two per file, of which
+	// the oldest is dropped.
+	var entries []*pb.LogEntry
+	for i := 0; i < 7; i++ {
+		entries = append(entries, newEntry(time.Unix(0, 0), pb.LogEntry_Severity_INFO, "msg"+string(rune('0'+i))))
+	}
+	if err := sink.Send(&pb.LogEntry_List{LogEntries: entries[:3]}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := sink.Send(&pb.LogEntry_List{LogEntries: entries[3:]}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := sink.(io.Closer).Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	path := filepath.Join(dir, "logs", logFileName)
+	want := map[string][]string{
+		path:        {"msg6"},
+		path + ".1": {"msg4", "msg5"},
+		path + ".2": {"msg2", "msg3"},
+		path + ".3": nil,
+	}
+	for p, msgs := range want {
+		if got := readLogFile(t, p); strings.Join(got, ",") != strings.Join(msgs, ",") {
+			t.Errorf("%v has messages %v, want %v", filepath.Base(p), got, msgs)
+		}
+	}
+}
+
+func TestLogFileDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: &collectSink{}, fileDir: dir})
+	log.Info(ctx, "to file")
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got := readLogFile(t, filepath.Join(dir, logFileName))
+	if len(got) != 1 || !strings.HasPrefix(got[0], "to file") {
+		t.Errorf("log file has messages %q, want one starting with %q", got, "to file")
+	}
+}
@@ -0,0 +1,62 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// healthCounts are the totals of the writer as of its last health report.
+type healthCounts struct {
+	at         time.Time
+	sent       int64
+	dropped    int64
+	reconnects int64
+}
+
+// healthTimer returns a channel that receives once the next health report is
+// due, or nil if health reports are disabled. The reports are spaced by
+// healthInterval across reconnects.
+func (w *remoteWriter) healthTimer() <-chan time.Time {
+	if w.healthInterval <= 0 {
+		return nil
+	}
+	if w.health.at.IsZero() {
+		w.health.at = time.Now()
+	}
+	return time.After(time.Until(w.health.at.Add(w.healthInterval)))
+}
+
+// healthReport returns an INFO entry summarizing the entries sent and
+// dropped, and the reconnects, since the last report, for deployments without
+// the logging metrics.
+func (w *remoteWriter) healthReport(now time.Time) *pb.LogEntry {
+	cur := healthCounts{
+		at:         now,
+		sent:       w.sent,
+		dropped:    atomic.LoadInt64(&w.stats.dropped),
+		reconnects: w.reconnects,
+	}
+	msg := fmt.Sprintf("Remote logging health over the last %v: %v entries sent, %v dropped, %v reconnects",
+		cur.at.Sub(w.health.at).Round(time.Second), cur.sent-w.health.sent, cur.dropped-w.health.dropped, cur.reconnects-w.health.reconnects)
+	w.health = cur
+	return newEntry(now, w.severity(log.SevInfo), msg)
+}
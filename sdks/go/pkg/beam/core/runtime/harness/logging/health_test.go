@@ -0,0 +1,86 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogHealthReport(t *testing.T) {
+	start := time.Now()
+	w := &remoteWriter{
+		stats:      &logStats{dropped: 1},
+		sent:       5,
+		reconnects: 2,
+		health:     healthCounts{at: start, sent: 2},
+	}
+
+	entry := w.healthReport(start.Add(time.Minute))
+	want := "Remote logging health over the last 1m0s: 3 entries sent, 1 dropped, 2 reconnects"
+	if got := entry.GetMessage(); got != want {
+		t.Errorf("healthReport() = %q, want %q", got, want)
+	}
+	if got := entry.GetSeverity(); got != pb.LogEntry_Severity_INFO {
+		t.Errorf("healthReport() severity = %v, want INFO", got)
+	}
+
+	// The next report only covers what happened since.
+	w.sent++
+	entry = w.healthReport(start.Add(2 * time.Minute))
+	want = "Remote logging health over the last 1m0s: 1 entries sent, 0 dropped, 0 reconnects"
+	if got := entry.GetMessage(); got != want {
+		t.Errorf("healthReport() = %q, want %q", got, want)
+	}
+}
+
+func TestLogHealthDisabled(t *testing.T) {
+	w := &remoteWriter{}
+	if ch := w.healthTimer(); ch != nil {
+		t.Error("healthTimer() is non-nil, want no reports by default")
+	}
+}
+
+func TestLogHealthInterval(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, healthInterval: 20 * time.Millisecond})
+	defer r.Close(ctx)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sink.mu.Lock()
+		var found bool
+		for _, entry := range sink.entries {
+			if strings.HasPrefix(entry.GetMessage(), "Remote logging health") {
+				found = true
+			}
+		}
+		sink.mu.Unlock()
+		if found {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no health report sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,816 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging sends the log messages of the Go harness to the runner over
+// the FnLogging service. Start installs a logger that buffers the entries and
+// sends them in batches; Options configures its sinks, routes and levels.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+)
+
+type contextKey string
+
+// The thread key is copied by log.CopyContextMetadata.
+func init() {
+	log.RegisterContextKey(threadKey)
+}
+
+func tryGetInstID(ctx context.Context) (string, bool) {
+	return log.InstructionID(ctx)
+}
+
+// threadKey is the context key of an identifier for the concurrent unit of
+// work, such as a bundle being processed, which is reported as the thread of
+// log entries. It allows interleaved entries to be grouped.
+const threadKey contextKey = "beam:thread"
+
+// writerKey marks the context of a writer goroutine. Anything logged with it,
+// such as by a dial option, is buffered without being waited for, since the
+// writer would otherwise wait on itself.
+const writerKey contextKey = "beam:log:writer"
+
+// isWriter reports whether ctx is that of a writer goroutine.
+func isWriter(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(writerKey) != nil
+}
+
+// WithThreadID annotates the context with the identifier of the concurrent unit
+// of work, such as a bundle, which is reported as the thread of the entries
+// logged with it.
+func WithThreadID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, threadKey, id)
+}
+
+func tryGetThreadID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id := ctx.Value(threadKey)
+	if id == nil {
+		return "", false
+	}
+	return id.(string), true
+}
+
+// tryGetTransformID returns the primitive transform ID of the context. It
+// shares the context key used for metrics, which the exec package sets for
+// the transforms invoking user code.
+func tryGetTransformID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	return metrics.GetPTransformID(ctx)
+}
+
+// defaultFatalFlushTimeout is how long a fatal log message waits to be sent to
+// the FnLogging service before it is written to stderr instead, unless
+// configured otherwise. It is short, since the process is crashing.
+const defaultFatalFlushTimeout = 2 * time.Second
+
+// syncFlushTimeout is how long an entry logged in synchronous mode waits to be
+// sent before it is written to stderr instead.
+const syncFlushTimeout = 5 * time.Second
+
+type logger struct {
+	out chan *pb.LogEntry
+	// priority buffers entries of WARN severity or above.
+	priority chan *pb.LogEntry
+	// flushes is used to ask the writer to send all buffered entries.
+	flushes chan<- chan error
+	// level is the minimum log.Severity of entries that are logged. It is
+	// accessed atomically, so that it can be changed while logging.
+	level int32
+	// stats are shared with the writer.
+	stats *logStats
+	// now is the clock used to timestamp entries. If nil, time.Now is used.
+	now func() time.Time
+	// caller looks up the log location for the given calldepth. If nil,
+	// runtime.Caller is used.
+	caller func(calldepth int) (pc uintptr, file string, line int, ok bool)
+	// omitLocation skips the caller lookup, which is comparatively
+	// expensive, leaving LogLocation empty.
+	omitLocation bool
+	// fullLocation keeps the full path of the file in LogLocation, rather
+	// than trimming it with trimLocation.
+	fullLocation bool
+	// callerFailures counts the consecutive failed caller lookups, and
+	// callerWarned is set once the logger has warned about them. Both are
+	// accessed atomically. See missingCaller.
+	callerFailures int32
+	callerWarned   int32
+	// maxBytes caps the approximate size of the buffered entries, as
+	// computed by entrySize, beyond which entries are dropped. Zero means
+	// no cap.
+	maxBytes int64
+	// maxMessageSize is the length in bytes beyond which messages are
+	// truncated by truncateMessage. Zero means no limit.
+	maxMessageSize int
+	// traceLevel is the minimum severity of entries that get a stack trace,
+	// of at most maxTraceSize bytes. SevUnspecified means none do.
+	traceLevel   log.Severity
+	maxTraceSize int
+	// dropPolicy determines which entry is dropped if the buffer is full.
+	dropPolicy dropPolicy
+	// blockThreshold, if positive, is the number of entries in the regular
+	// buffer above which an entry waits up to blockTimeout for the writer to
+	// catch up, before it is buffered, or dropped. stalled is set,
+	// atomically, once a wait times out, until the buffer falls below the
+	// threshold. freed is signalled by the writer as it takes entries from
+	// the buffer. See await.
+	blockThreshold int
+	blockTimeout   time.Duration
+	stalled        int32
+	freed          chan struct{}
+	// highWater is the largest number of entries buffered at once so far.
+	// It is accessed atomically. See observeFill.
+	highWater int64
+	// fallbackFormat is the format of entries written to stderr, if they
+	// can't be sent.
+	fallbackFormat fallbackFormat
+	// color colorizes plain entries written to stderr by severity.
+	color bool
+	// stderr receives the entries written to stderr. If nil, os.Stderr is
+	// used.
+	stderr io.Writer
+	// dedup, if set, coalesces repeated messages.
+	dedup *deduper
+	// sampler, if set, limits the rate of messages from each call site. It
+	// requires the location.
+	sampler *siteSampler
+	// tees receive a copy of each entry, in addition to the writer. They
+	// only buffer entries, so their other settings are unused.
+	tees []*logger
+	// routeLevel, if set, is the minimum severity of the entries received
+	// by a tee, which isn't waited for in synchronous mode. See Route.
+	routeLevel log.Severity
+	// synchronous makes each entry wait until it is sent, as is always done
+	// for fatal entries.
+	synchronous bool
+	// fatalFlush bounds how long a fatal entry waits to be sent. If unset,
+	// defaultFatalFlushTimeout is used.
+	fatalFlush time.Duration
+	// packages, if set, override level for the packages they match.
+	packages *packageLevels
+	// suffix is appended to every message, such as the fields identifying
+	// the worker, if they are to be part of the message.
+	suffix string
+	// recorder, if set, keeps the recent entries of at least recordLevel
+	// that aren't sent, because they are below the level or logging is
+	// muted, which are sent ahead of a fatal entry.
+	recorder    *ringSink
+	recordLevel log.Severity
+	// eventTime stamps entries with the event time of their context, if
+	// any, rather than the time they are logged.
+	eventTime bool
+	// redact, if set, matches the parts of messages that are redacted.
+	redact *regexp.Regexp
+	// severities, if set, maps the severities of messages to those of
+	// entries, instead of convertSeverity.
+	severities SeverityMapping
+	// spanContext, if set, looks up the trace span whose IDs are added to
+	// the fields of messages.
+	spanContext SpanContextFunc
+	// muted is set, atomically, while logging is muted, and suppressed is
+	// the number of entries suppressed since it was set. See Mute.
+	muted      int32
+	suppressed int64
+	// draining is set, atomically, once Drain is called. Entries are then
+	// written to stderr instead of being buffered.
+	draining int32
+	// config holds the settings of the writer, as reported by Config.
+	config Config
+}
+
+// dropPolicy determines which entry is dropped when an entry is logged while
+// the buffer is full.
+type dropPolicy int
+
+const (
+	// dropNewest drops the entry being logged, keeping the buffered ones.
+	dropNewest dropPolicy = iota
+	// dropOldest drops the oldest buffered entry to make room, keeping the
+	// most recent entries, which are often the most relevant near a crash.
+	dropOldest
+)
+
+// parseDropPolicy returns the drop policy with the given name, "newest" or
+// "oldest".
+func parseDropPolicy(name string) (dropPolicy, error) {
+	switch strings.ToLower(name) {
+	case "newest":
+		return dropNewest, nil
+	case "oldest":
+		return dropOldest, nil
+	default:
+		return dropNewest, fmt.Errorf("invalid drop policy %q", name)
+	}
+}
+
+// logStats are counters of the remote logging, shared by the logger and the
+// writer. They are accessed atomically.
+type logStats struct {
+	// dropped is the number of entries dropped because the buffer was full,
+	// or because they repeatedly failed to be sent.
+	dropped int64
+	// bufferedBytes is the approximate size of the buffered entries.
+	bufferedBytes int64
+	// sampled is the number of entries dropped because their call site
+	// exceeded its rate.
+	sampled int64
+	// lastErr holds the last failure of the writer since it last connected,
+	// in an errorHolder.
+	lastErr atomic.Value
+}
+
+// entrySize returns the approximate number of bytes held by the entry, which
+// is dominated by its strings.
+func entrySize(entry *pb.LogEntry) int64 {
+	return int64(len(entry.GetMessage()) + len(entry.GetTrace()) + len(entry.GetLogLocation()))
+}
+
+// Dropped returns the number of entries dropped so far because the buffer was
+// full, or because they couldn't be sent.
+func (l *logger) Dropped() int64 {
+	return atomic.LoadInt64(&l.stats.dropped)
+}
+
+// Sampled returns the number of entries dropped so far because their call
+// site exceeded its rate.
+func (l *logger) Sampled() int64 {
+	return atomic.LoadInt64(&l.stats.sampled)
+}
+
+// setLevel sets the minimum severity of entries that are logged.
+func (l *logger) setLevel(sev log.Severity) {
+	atomic.StoreInt32(&l.level, int32(sev))
+}
+
+// enabled returns whether entries of the given severity are logged, from
+// some package at least.
+func (l *logger) enabled(sev log.Severity) bool {
+	level := log.Severity(atomic.LoadInt32(&l.level))
+	if l.packages != nil && !l.packages.min.AtLeast(level) {
+		level = l.packages.min
+	}
+	return sev.AtLeast(level)
+}
+
+// enabledAt returns whether entries of the given severity are logged from the
+// function at the program counter, if they are enabled at all.
+func (l *logger) enabledAt(pc uintptr, sev log.Severity) bool {
+	if l.packages == nil {
+		return true
+	}
+	level, ok := l.packages.level(pc)
+	if !ok {
+		level = log.Severity(atomic.LoadInt32(&l.level))
+	}
+	return sev.AtLeast(level)
+}
+
+// Enabled reports whether entries of the given severity are logged, or kept
+// by the recorder. It implements log.Enabler.
+func (l *logger) Enabled(ctx context.Context, sev log.Severity) bool {
+	return l.enabled(sev) || l.records(sev)
+}
+
+func (l *logger) Log(ctx context.Context, sev log.Severity, calldepth int, msg string) {
+	l.log(ctx, nil, sev, calldepth, msg)
+}
+
+// log logs the message with the references and fields of the binding, if set,
+// or else of ctx. It must be called directly by Log, or an equivalent method,
+// whose calldepth it is given. A nil ctx is treated as an empty one, rather
+// than panicking in the middle of logging.
+func (l *logger) log(ctx context.Context, b *binding, sev log.Severity, calldepth int, msg string) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !l.enabled(sev) {
+		if l.records(sev) {
+			l.record(ctx, b, sev, msg)
+		}
+		return
+	}
+
+	var file string
+	var line int
+	if !l.omitLocation || l.packages != nil {
+		var pc uintptr
+		var f string
+		var n int
+		var ok bool
+		if l.caller != nil {
+			pc, f, n, ok = l.caller(calldepth)
+		} else {
+			pc, f, n, ok = runtime.Caller(calldepth + 1) // +1 for this frame
+		}
+		if !ok {
+			l.missingCaller(calldepth)
+		} else {
+			l.foundCaller()
+		}
+		if ok && !l.enabledAt(pc, sev) {
+			if l.records(sev) {
+				l.record(ctx, b, sev, msg)
+			}
+			return
+		}
+		if ok && !l.omitLocation {
+			file, line = f, n
+		}
+	}
+	l.output(ctx, b, sev, l.timeNow(), file, line, msg)
+}
+
+// output writes an entry for a message of enabled severity, logged at the
+// given time and location. An empty file means the location is unknown. The
+// references and fields are those of the binding, if set, or else of ctx.
+func (l *logger) output(ctx context.Context, b *binding, sev log.Severity, t time.Time, file string, line int, msg string) {
+	if l.sampler != nil && file != "" && sev != log.SevFatal && !l.sampler.allow(t, file, line) {
+		atomic.AddInt64(&l.stats.sampled, 1)
+		return
+	}
+
+	msg = l.message(ctx, b, msg)
+	entry := newEntry(l.stamp(ctx, t), l.severity(sev), msg)
+	if file != "" {
+		if !l.fullLocation {
+			file = trimLocation(file)
+		}
+		entry.LogLocation = fmt.Sprintf("%v:%v", file, line)
+	}
+	b.setReferences(ctx, entry)
+
+	// The windows of the sampler and the deduplication are in wall-clock
+	// time, regardless of the timestamp.
+	if l.dedup != nil {
+		l.writeRepeats(ctx, l.dedup.expire(t, false))
+		if sev != log.SevFatal {
+			suppressed, changed := l.dedup.suppress(t, sev, entry)
+			l.writeRepeats(ctx, changed)
+			if suppressed {
+				releaseEntry(entry)
+				return
+			}
+		}
+	}
+	if l.traceLevel != log.SevUnspecified && sev.AtLeast(l.traceLevel) {
+		entry.Trace = stackTrace(l.maxTraceSize)
+	}
+	l.write(ctx, sev, entry)
+}
+
+// message returns the message of an entry, with the fields of the binding and
+// the context, the trace span, and the suffix appended, redacted, sanitized and
+// truncated.
+func (l *logger) message(ctx context.Context, b *binding, msg string) string {
+	fields := l.spanFields(ctx, b.mergeFields(ctx))
+	msg = redact(l.redact, appendFields(msg, fields)+l.suffix)
+	return truncateMessage(sanitizeMessage(msg), l.maxMessageSize)
+}
+
+// writeRepeats writes an entry for each message whose repeats were
+// suppressed, as if logged with ctx.
+func (l *logger) writeRepeats(ctx context.Context, repeats []repeat) {
+	for _, r := range repeats {
+		l.write(ctx, r.sev, r.entry(l.severity(r.sev)))
+	}
+}
+
+// stackTrace returns the stack trace of the calling goroutine, truncated to
+// at most size bytes.
+func stackTrace(size int) string {
+	stack := make([]byte, size)
+	return string(stack[:runtime.Stack(stack, false)])
+}
+
+// sanitizeMessage replaces each run of bytes of the message that aren't valid
+// UTF-8 with the Unicode replacement character. Proto strings must be valid
+// UTF-8, so an entry with arbitrary bytes, such as a logged []byte, could
+// otherwise fail to marshal and break the stream.
+func sanitizeMessage(msg string) string {
+	if utf8.ValidString(msg) {
+		return msg
+	}
+	// This is strings.ToValidUTF8, which isn't available before Go 1.13.
+	var b strings.Builder
+	b.Grow(len(msg))
+	invalid := false
+	for i := 0; i < len(msg); {
+		r, size := utf8.DecodeRuneInString(msg[i:])
+		if r == utf8.RuneError && size == 1 {
+			if !invalid {
+				b.WriteRune(utf8.RuneError)
+				invalid = true
+			}
+		} else {
+			b.WriteString(msg[i : i+size])
+			invalid = false
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// truncateMessage shortens a message longer than limit bytes, if limit is
+// positive, to at most limit bytes followed by a marker of the number of bytes
+// removed. It never splits a multibyte UTF-8 encoded rune.
+func truncateMessage(msg string, limit int) string {
+	if limit <= 0 || len(msg) <= limit {
+		return msg
+	}
+	n := limit
+	for n > 0 && !utf8.RuneStart(msg[n]) {
+		n--
+	}
+	return fmt.Sprintf("%v...[truncated %v bytes]", msg[:n], len(msg)-n)
+}
+
+// trimLocation shortens the path of a source file to its last two elements,
+// such as "harness/logging.go", which avoids leaking the paths of the build
+// host into the logs.
+func trimLocation(file string) string {
+	i := strings.LastIndexByte(file, '/')
+	if i < 0 {
+		return file
+	}
+	if j := strings.LastIndexByte(file[:i], '/'); j >= 0 {
+		return file[j+1:]
+	}
+	return file
+}
+
+// timeNow returns the current time according to the logger's clock.
+func (l *logger) timeNow() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+// stamp returns the timestamp of an entry logged with ctx at time t, which is
+// the event time of ctx, if any, when the logger uses event time.
+func (l *logger) stamp(ctx context.Context, t time.Time) time.Time {
+	if l.eventTime {
+		if et, ok := log.EventTime(ctx); ok {
+			return et
+		}
+	}
+	return t
+}
+
+// newEntry returns an entry with the given timestamp, severity and message.
+// The entry is taken from entryPool.
+func newEntry(t time.Time, sev pb.LogEntry_Severity_Enum, msg string) *pb.LogEntry {
+	entry := entryPool.Get().(*pb.LogEntry)
+	entry.Timestamp.Seconds = t.Unix()
+	entry.Timestamp.Nanos = int32(t.Nanosecond())
+	entry.Severity = sev
+	entry.Message = msg
+	return entry
+}
+
+// entryPool holds entries for reuse, along with their timestamps, to reduce
+// the allocations per logged message.
+var entryPool = sync.Pool{
+	New: func() interface{} {
+		return &pb.LogEntry{Timestamp: &tspb.Timestamp{}}
+	},
+}
+
+// copyEntry returns a copy of the entry, taken from entryPool.
+func copyEntry(entry *pb.LogEntry) *pb.LogEntry {
+	c := entryPool.Get().(*pb.LogEntry)
+	c.Timestamp.Seconds = entry.GetTimestamp().GetSeconds()
+	c.Timestamp.Nanos = entry.GetTimestamp().GetNanos()
+	c.Severity = entry.Severity
+	c.Message = entry.Message
+	c.Trace = entry.Trace
+	c.InstructionReference = entry.InstructionReference
+	c.PrimitiveTransformReference = entry.PrimitiveTransformReference
+	c.LogLocation = entry.LogLocation
+	c.Thread = entry.Thread
+	return c
+}
+
+// releaseEntry returns the entry to entryPool. The entry must no longer be
+// referenced, including by a batch that may still be sent.
+func releaseEntry(entry *pb.LogEntry) {
+	ts := entry.Timestamp
+	entry.Reset()
+	if ts == nil {
+		ts = &tspb.Timestamp{}
+	}
+	entry.Timestamp = ts
+	entryPool.Put(entry)
+}
+
+// setReferences sets the instruction and transform references of the entry
+// from the context.
+func setReferences(ctx context.Context, entry *pb.LogEntry) {
+	if id, ok := tryGetInstID(ctx); ok {
+		entry.InstructionReference = id
+	}
+	if id, ok := tryGetTransformID(ctx); ok {
+		entry.PrimitiveTransformReference = id
+	}
+	if id, ok := tryGetThreadID(ctx); ok {
+		entry.Thread = id
+	}
+}
+
+// appendFields appends the fields to the message in a stable key=value form,
+// sorted by key. LogEntry has no place for arbitrary structured data, so this
+// keeps the fields parseable by the runner's log handling.
+func appendFields(msg string, fields log.Fields) string {
+	if len(fields) == 0 {
+		return msg
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, k := range keys {
+		b.WriteByte(' ')
+		b.WriteString(k)
+		b.WriteByte('=')
+		if v := fields[k]; v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			b.WriteString(strconv.Quote(v))
+		} else {
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+// FlushOnPanic recovers a panic, if any, and logs it as a critical entry along
+// with the stack of the panicking goroutine. It then waits for the buffered
+// entries to be sent, bounded by the fatal flush timeout, and re-panics. It
+// must be called directly by a deferred statement.
+func (l *logger) FlushOnPanic(ctx context.Context) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := make([]byte, 64<<10)
+	stack = stack[:runtime.Stack(stack, false)]
+
+	msg := redact(l.redact, fmt.Sprintf("panic: %v", r))
+	entry := newEntry(l.stamp(ctx, l.timeNow()), l.severity(log.SevFatal), sanitizeMessage(msg))
+	entry.Trace = string(stack)
+	setReferences(ctx, entry)
+	l.write(ctx, log.SevFatal, entry)
+
+	panic(r)
+}
+
+// write enqueues the entry for the writer, and a copy of it for each tee.
+// Fatal entries, and all entries in synchronous mode, are flushed before write
+// returns, unless ctx is that of a writer. A fatal entry is preceded by the
+// entries kept by the recorder, as context for the crash. While logging is
+// muted, entries other than fatal ones are only kept by the recorder, if any.
+func (l *logger) write(ctx context.Context, sev log.Severity, entry *pb.LogEntry) {
+	if sev == log.SevFatal && l.recorder != nil {
+		l.sendRecorded()
+	}
+	if sev != log.SevFatal && atomic.LoadInt32(&l.muted) != 0 {
+		atomic.AddInt64(&l.suppressed, 1)
+		loggingMuted.Inc(loggingMetricsCtx, 1)
+		if l.records(sev) {
+			l.recorder.add(entry)
+		} else {
+			releaseEntry(entry)
+		}
+		return
+	}
+	l.deliver(ctx, sev, entry)
+}
+
+// deliver enqueues the entry for the writer, and a copy of it for each tee,
+// flushing it if needed.
+func (l *logger) deliver(ctx context.Context, sev log.Severity, entry *pb.LogEntry) {
+	if atomic.LoadInt32(&l.draining) != 0 {
+		fmt.Fprintln(l.fallback(), formatFallback(entry, l.fallbackFormat, l.color))
+		releaseEntry(entry)
+		return
+	}
+	// A writer doesn't wait on the buffers, or for the entry to be sent.
+	block := !isWriter(ctx)
+	// The entry may be released once buffered, so it is copied first.
+	for _, t := range l.tees {
+		if sev.AtLeast(t.routeLevel) {
+			t.buffer(sev, copyEntry(entry), block)
+		}
+	}
+	// The entry may be sent and released before a failed flush is noticed,
+	// so its fallback form is kept beforehand.
+	wait := (sev == log.SevFatal || l.synchronous) && block
+	var fallback string
+	if wait {
+		fallback = formatFallback(entry, l.fallbackFormat, l.color)
+	}
+	if !l.buffer(sev, entry, block) || !wait {
+		return
+	}
+
+	switch {
+	case sev == log.SevFatal:
+		// The process is likely about to exit, so make sure the message
+		// reaches the runner before returning. This is bounded independently
+		// of ctx, which may already be cancelled.
+		ctx, cancel := context.WithTimeout(context.Background(), l.fatalTimeout())
+		defer cancel()
+
+		if err := l.Flush(ctx); err != nil {
+			fmt.Fprintln(l.fallback(), fallback)
+		}
+	case l.synchronous:
+		// Unlike Flush, this leaves the deduplication windows open.
+		ctx, cancel := context.WithTimeout(context.Background(), syncFlushTimeout)
+		defer cancel()
+
+		err := l.flush(ctx)
+		for _, t := range l.tees {
+			if t.routeLevel != log.SevUnspecified {
+				continue
+			}
+			if terr := t.flush(ctx); err == nil {
+				err = terr
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(l.fallback(), fallback)
+		}
+	}
+}
+
+// fatalTimeout returns how long a fatal entry waits to be sent.
+func (l *logger) fatalTimeout() time.Duration {
+	if l.fatalFlush <= 0 {
+		return defaultFatalFlushTimeout
+	}
+	return l.fatalFlush
+}
+
+// buffer enqueues the entry for the writer, or drops it to stderr if the
+// buffers are full. It returns whether the entry was enqueued. If block is set,
+// it may wait for the writer to catch up first. See await.
+func (l *logger) buffer(sev log.Severity, entry *pb.LogEntry, block bool) bool {
+	if !l.enqueue(sev, entry, block) {
+		l.drop(entry)
+		return false
+	}
+	return true
+}
+
+// drop counts an entry that didn't fit in the buffers and writes its message
+// to stderr instead.
+func (l *logger) drop(entry *pb.LogEntry) {
+	atomic.AddInt64(&l.stats.dropped, 1)
+	loggingDropped.Inc(loggingMetricsCtx, 1)
+	fmt.Fprintln(l.fallback(), formatFallback(entry, l.fallbackFormat, l.color))
+	releaseEntry(entry)
+}
+
+// enqueue adds the entry to the buffer without blocking. Entries of WARN
+// severity or above go to the priority buffer, which the writer drains first,
+// so that a flood of less severe entries can't crowd them out. They fall back
+// to the regular buffer if the priority buffer is full. The entry is rejected
+// if it doesn't fit in the buffer, or would exceed maxBytes.
+func (l *logger) enqueue(sev log.Severity, entry *pb.LogEntry, block bool) bool {
+	n := entrySize(entry)
+	if b := atomic.AddInt64(&l.stats.bufferedBytes, n); l.maxBytes > 0 && b > l.maxBytes {
+		atomic.AddInt64(&l.stats.bufferedBytes, -n)
+		return false
+	}
+	if l.push(sev, entry, block) {
+		l.observeFill()
+		return true
+	}
+	atomic.AddInt64(&l.stats.bufferedBytes, -n)
+	return false
+}
+
+// spill drops the entries remaining in the buffers, writing them to stderr.
+func (l *logger) spill() {
+	for {
+		var entry *pb.LogEntry
+		select {
+		case entry = <-l.priority:
+		case entry = <-l.out:
+		default:
+			return
+		}
+		atomic.AddInt64(&l.stats.bufferedBytes, -entrySize(entry))
+		l.drop(entry)
+	}
+}
+
+// push adds the entry to the priority or regular buffer, if there is room.
+func (l *logger) push(sev log.Severity, entry *pb.LogEntry, block bool) bool {
+	if sev.AtLeast(log.SevWarn) {
+		select {
+		case l.priority <- entry:
+			return true
+		default:
+		}
+	}
+	if block && l.blockThreshold > 0 && sev != log.SevFatal {
+		l.await()
+	}
+	select {
+	case l.out <- entry:
+		return true
+	default:
+	}
+	if l.dropPolicy != dropOldest {
+		return false
+	}
+
+	// Make room by dropping the oldest entry. The writer may take it first,
+	// or another entry may take its place, in which case this one is dropped
+	// after all.
+	select {
+	case old := <-l.out:
+		atomic.AddInt64(&l.stats.bufferedBytes, -entrySize(old))
+		l.drop(old)
+	default:
+	}
+	select {
+	case l.out <- entry:
+		return true
+	default:
+		return false
+	}
+}
+
+// Flush blocks until all entries buffered so far, including any partial
+// batch, have been sent on the stream and by the tees, or until the context
+// is done. It returns the first error encountered.
+func (l *logger) Flush(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if l.dedup != nil {
+		l.writeRepeats(ctx, l.dedup.expire(l.timeNow(), true))
+	}
+	err := l.flush(ctx)
+	for _, t := range l.tees {
+		if terr := t.Flush(ctx); err == nil {
+			err = terr
+		}
+	}
+	return err
+}
+
+// flush asks the writer to send the buffered entries and waits for it.
+func (l *logger) flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case l.flushes <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,1698 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/core/metrics"
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/util/grpcx"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestNextBackoff(t *testing.T) {
+	w := &remoteWriter{backoffBase: 100 * time.Millisecond, backoffMax: 1 * time.Second}
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, base := range want {
+		base *= time.Millisecond
+		got := w.nextBackoff()
+		if lo, hi := base*8/10, base*12/10; got < lo || got > hi {
+			t.Errorf("nextBackoff() #%v = %v, want in [%v, %v]", i, got, lo, hi)
+		}
+	}
+
+	w.backoff = 0
+	if got := w.nextBackoff(); got > 120*time.Millisecond {
+		t.Errorf("nextBackoff() after reset = %v, want at most 120ms", got)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		want  log.Severity
+		err   bool
+	}{
+		{"", log.SevInfo, false},
+		{"trace", log.SevTrace, false},
+		{"debug", log.SevDebug, false},
+		{"INFO", log.SevInfo, false},
+		{"notice", log.SevNotice, false},
+		{"warning", log.SevWarn, false},
+		{"Error", log.SevError, false},
+		{"critical", log.SevFatal, false},
+		{"verbose", log.SevInfo, true},
+	}
+	for _, test := range tests {
+		got, err := ParseLevel(test.level)
+		if got != test.want || (err != nil) != test.err {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v, error: %v", test.level, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestSeverityRoundTrip(t *testing.T) {
+	// Values without a log.Severity of their own don't survive the round
+	// trip.
+	lossy := map[pb.LogEntry_Severity_Enum]pb.LogEntry_Severity_Enum{
+		pb.LogEntry_Severity_UNSPECIFIED: pb.LogEntry_Severity_INFO,
+	}
+	for v := range pb.LogEntry_Severity_Enum_name {
+		sev := pb.LogEntry_Severity_Enum(v)
+		want, ok := lossy[sev]
+		if !ok {
+			want = sev
+		}
+		if got := convertSeverity(fromProtoSeverity(sev)); got != want {
+			t.Errorf("convertSeverity(fromProtoSeverity(%v)) = %v, want %v", sev, got, want)
+		}
+	}
+	if got := fromProtoSeverity(pb.LogEntry_Severity_Enum(100)); got != log.SevUnspecified {
+		t.Errorf("fromProtoSeverity(100) = %v, want %v", got, log.SevUnspecified)
+	}
+}
+
+func TestAppendFields(t *testing.T) {
+	tests := []struct {
+		msg    string
+		fields log.Fields
+		want   string
+	}{
+		{"msg", nil, "msg"},
+		{"msg", log.Fields{"stage": "s1"}, "msg stage=s1"},
+		{"msg", log.Fields{"worker": "w 1", "bundle": "b1", "empty": ""}, `msg bundle=b1 empty="" worker="w 1"`},
+	}
+	for _, test := range tests {
+		if got := appendFields(test.msg, test.fields); got != test.want {
+			t.Errorf("appendFields(%q, %v) = %q, want %q", test.msg, test.fields, got, test.want)
+		}
+	}
+}
+
+func TestWithFieldsOverride(t *testing.T) {
+	ctx := log.WithFields(context.Background(), log.Fields{"stage": "outer", "worker": "w1"})
+	ctx = log.WithFields(ctx, log.Fields{"stage": "inner"})
+
+	if got, want := appendFields("msg", log.FieldsFromContext(ctx)), "msg stage=inner worker=w1"; got != want {
+		t.Errorf("fields = %q, want %q", got, want)
+	}
+}
+
+func TestLogReferences(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	l := &logger{out: buf, stats: &logStats{}}
+
+	ctx := metrics.SetPTransformID(log.WithInstructionID(context.Background(), "inst1"), "ptransform1")
+	l.Log(ctx, log.SevInfo, 0, "msg")
+
+	entry := <-buf
+	if got, want := entry.GetInstructionReference(), "inst1"; got != want {
+		t.Errorf("InstructionReference = %q, want %q", got, want)
+	}
+	if got, want := entry.GetPrimitiveTransformReference(), "ptransform1"; got != want {
+		t.Errorf("PrimitiveTransformReference = %q, want %q", got, want)
+	}
+	if got := entry.GetThread(); got != "" {
+		t.Errorf("Thread = %q, want none", got)
+	}
+
+	l.Log(WithThreadID(ctx, "bundle-1"), log.SevInfo, 0, "msg")
+	if got, want := (<-buf).GetThread(), "bundle-1"; got != want {
+		t.Errorf("Thread = %q, want %q", got, want)
+	}
+}
+
+func TestLogFatalFlushTimeout(t *testing.T) {
+	var out syncBuffer
+	// No writer acknowledges the flush, so the fatal entry times out.
+	l := &logger{
+		out:        make(chan *pb.LogEntry, 1),
+		priority:   make(chan *pb.LogEntry, 1),
+		flushes:    make(chan chan error),
+		stats:      &logStats{},
+		stderr:     &out,
+		fatalFlush: 20 * time.Millisecond,
+	}
+
+	start := time.Now()
+	l.Log(context.Background(), log.SevFatal, 1, "crashing")
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > defaultFatalFlushTimeout {
+		t.Errorf("fatal entry returned after %v, want about 20ms", elapsed)
+	}
+	if got := out.String(); got != "*** CRITICAL: crashing\n" {
+		t.Errorf("fallback output = %q, want the fatal message", got)
+	}
+}
+
+func TestLogNilContext(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 2)
+	l := &logger{out: buf, stats: &logStats{}, eventTime: true}
+
+	var ctx context.Context // nil, as passed by mistake
+	l.Log(ctx, log.SevInfo, 1, "nil context")
+	l.With(ctx).Log(ctx, log.SevInfo, 1, "bound to nil context")
+	for _, want := range []string{"nil context", "bound to nil context"} {
+		entry := <-buf
+		if entry.GetMessage() != want || entry.GetInstructionReference() != "" {
+			t.Errorf("entry = %q for instruction %q, want %q for none", entry.GetMessage(), entry.GetInstructionReference(), want)
+		}
+	}
+}
+
+func TestLogDropped(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	l := &logger{out: buf, stats: &logStats{}}
+
+	for i := 0; i < 3; i++ {
+		l.Log(context.Background(), log.SevInfo, 0, "msg")
+	}
+	if got, want := l.Dropped(), int64(2); got != want {
+		t.Errorf("Dropped() = %v, want %v", got, want)
+	}
+}
+
+func TestLogDropOldest(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 2)
+	l := &logger{out: buf, stats: &logStats{}, dropPolicy: dropOldest}
+
+	for i := 0; i < 4; i++ {
+		l.Log(context.Background(), log.SevInfo, 0, fmt.Sprintf("msg%v", i))
+	}
+	if got, want := l.Dropped(), int64(2); got != want {
+		t.Errorf("Dropped() = %v, want %v", got, want)
+	}
+	for _, want := range []string{"msg2", "msg3"} {
+		if got := (<-buf).GetMessage(); got != want {
+			t.Errorf("buffered %q, want %q", got, want)
+		}
+	}
+}
+
+func TestLogDroppedBytes(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 10)
+	l := &logger{out: buf, stats: &logStats{}, omitLocation: true, maxBytes: 10}
+
+	for i := 0; i < 3; i++ {
+		l.Log(context.Background(), log.SevInfo, 0, "12345")
+	}
+	if got, want := l.Dropped(), int64(1); got != want {
+		t.Errorf("Dropped() = %v, want %v", got, want)
+	}
+
+	// Taking an entry from the buffer makes room for another.
+	w := &remoteWriter{stats: l.stats}
+	w.take(nil, <-buf)
+	l.Log(context.Background(), log.SevInfo, 0, "12345")
+	if got, want := len(buf), 2; got != want {
+		t.Errorf("buffered %v entries, want %v", got, want)
+	}
+}
+
+func TestLoggingDialKeepalive(t *testing.T) {
+	srv, _, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	ctx := context.Background()
+	opts := Options{
+		DialOptions: []grpc.DialOption{grpc.WithInsecure(), srv.Dialer()},
+		keepalive:   keepalive.ClientParameters{Time: 10 * time.Second, Timeout: time.Second},
+	}
+	r := Start(ctx, "bufconn:direct", opts)
+	defer r.Close(ctx)
+
+	log.Info(ctx, "with keepalive")
+	srv.WaitForEntries(t, "with keepalive", 1)
+}
+
+func TestLoggingCustomizedDialer(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	// A dialer customized without support for dial options is used without
+	// the keepalive parameters.
+	prev := grpcx.DialWithOptions
+	grpcx.DialWithOptions = func(ctx context.Context, e string, timeout time.Duration, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+		if len(opts) > 0 {
+			return nil, grpcx.ErrDialOptions
+		}
+		return prev(ctx, e, timeout)
+	}
+	defer func() { grpcx.DialWithOptions = prev }()
+
+	var out syncBuffer
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{FallbackWriter: &out})
+	defer r.Close(ctx)
+
+	log.Info(ctx, "without keepalive")
+	srv.WaitForEntries(t, "without keepalive", 1)
+	if want := "keepalive disabled"; !strings.Contains(out.String(), want) {
+		t.Errorf("fallback output %q doesn't contain %q", out.String(), want)
+	}
+}
+
+func TestLoggingDialTimeout(t *testing.T) {
+	// Nothing listens on the address once the listener is closed.
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	w := &remoteWriter{endpoint: addr, stats: &logStats{}, dialTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	if err := w.connect(context.Background()); err == nil {
+		t.Fatalf("connect to %v succeeded", addr)
+	}
+	if elapsed := time.Since(start); elapsed > defaultDialTimeout/2 {
+		t.Errorf("connect failed after %v, want about %v", elapsed, w.dialTimeout)
+	}
+}
+
+func TestLoggingMaxRetries(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	// The entries written to stderr are seen by the hooks too.
+	gaveUp := make(chan string, 10)
+	hook := func(list *pb.LogEntry_List) {
+		for _, e := range list.GetLogEntries() {
+			gaveUp <- e.GetMessage()
+		}
+	}
+
+	ctx := context.Background()
+	opts := Options{Hooks: []EntriesHook{hook}, maxRetries: 1, dialTimeout: 50 * time.Millisecond}
+	r := startLogging(ctx, addr, nil, opts.withDefaults())
+	defer func() {
+		r.cancel()
+		<-r.Done()
+	}()
+
+	select {
+	case msg := <-gaveUp:
+		if !strings.HasPrefix(msg, "Remote logging gave up after 2 failed attempts") {
+			t.Errorf("first entry = %q, want a warning about giving up", msg)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("writer didn't give up")
+	}
+}
+
+func TestLogFlushInterval(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, flushInterval: 10 * time.Millisecond})
+	defer r.Close(ctx)
+
+	// A partial batch is sent without an explicit flush.
+	log.Info(ctx, "partial batch")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sink.mu.Lock()
+		n := len(sink.entries)
+		sink.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if n > 1 || time.Now().After(deadline) {
+			t.Fatalf("sink received %v entries, want 1", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLogBatchSize(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, batchSize: 3, flushInterval: time.Hour})
+	defer r.Close(ctx)
+
+	// A full batch is sent without waiting for the flush interval.
+	for i := 0; i < 3; i++ {
+		log.Infof(ctx, "entry %v", i)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sink.mu.Lock()
+		n := len(sink.entries)
+		sink.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sink received %v entries, want 3", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLogTimestamp(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	now := time.Date(2018, time.October, 12, 10, 30, 0, 500, time.UTC)
+	l := &logger{out: buf, stats: &logStats{}, now: func() time.Time { return now }}
+
+	l.Log(context.Background(), log.SevWarn, 0, "msg")
+
+	entry := <-buf
+	if got, _ := ptypes.Timestamp(entry.GetTimestamp()); !got.Equal(now) {
+		t.Errorf("Timestamp = %v, want %v", got, now)
+	}
+	if got, want := entry.GetSeverity(), pb.LogEntry_Severity_WARN; got != want {
+		t.Errorf("Severity = %v, want %v", got, want)
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	tests := []struct {
+		msg   string
+		limit int
+		want  string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hello...[truncated 6 bytes]"},
+		{"héllo", 2, "h...[truncated 5 bytes]"}, // é is 2 bytes
+		{"héllo", 3, "hé...[truncated 3 bytes]"},
+		{"日本", 1, "...[truncated 6 bytes]"},
+	}
+	for _, test := range tests {
+		if got := truncateMessage(test.msg, test.limit); got != test.want {
+			t.Errorf("truncateMessage(%q, %v) = %q, want %q", test.msg, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeMessage(t *testing.T) {
+	tests := []struct {
+		msg, want string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"héllo, 世界", "héllo, 世界"},
+		{"bad \xff\xfe bytes", "bad \uFFFD bytes"},
+		{"\xc3", "\uFFFD"},
+		{"a\xffb\xfe", "a\uFFFDb\uFFFD"},
+		{"\uFFFD\xff", "\uFFFD\uFFFD"},
+	}
+	for _, test := range tests {
+		if got := sanitizeMessage(test.msg); got != test.want {
+			t.Errorf("sanitizeMessage(%q) = %q, want %q", test.msg, got, test.want)
+		}
+	}
+}
+
+func TestTrimLocation(t *testing.T) {
+	tests := []struct {
+		file, want string
+	}{
+		{"/home/runner/go/src/github.com/apache/beam/sdks/go/pkg/beam/core/runtime/harness/logging.go", "harness/logging.go"},
+		{"harness/logging.go", "harness/logging.go"},
+		{"/logging.go", "/logging.go"},
+		{"logging.go", "logging.go"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := trimLocation(test.file); got != test.want {
+			t.Errorf("trimLocation(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestLogLocation(t *testing.T) {
+	tests := []struct {
+		sev  log.Severity
+		ok   bool
+		full bool
+		want string
+	}{
+		{log.SevInfo, true, false, "to/file.go:42"},
+		{log.SevInfo, true, true, "/path/to/file.go:42"},
+		{log.SevInfo, false, false, ""},
+		{log.SevDebug, true, false, ""}, // filtered out before the lookup
+	}
+	for _, test := range tests {
+		buf := make(chan *pb.LogEntry, 1)
+		var depth int
+		l := &logger{out: buf, stats: &logStats{}, caller: func(calldepth int) (uintptr, string, int, bool) {
+			depth = calldepth
+			return 0, "/path/to/file.go", 42, test.ok
+		}, fullLocation: test.full}
+		l.setLevel(log.SevInfo)
+
+		l.Log(context.Background(), test.sev, 3, "msg")
+
+		if !test.sev.AtLeast(log.SevInfo) {
+			if depth != 0 || len(buf) != 0 {
+				t.Errorf("Log(%v) looked up caller %v and buffered %v entries, want none", test.sev, depth, len(buf))
+			}
+			continue
+		}
+		if depth != 3 {
+			t.Errorf("Log(%v) looked up calldepth %v, want 3", test.sev, depth)
+		}
+		if got := (<-buf).GetLogLocation(); got != test.want {
+			t.Errorf("Log(%v) with lookup ok %v: LogLocation = %q, want %q", test.sev, test.ok, got, test.want)
+		}
+	}
+}
+
+func TestLogHelpersLocation(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Level: log.SevTrace, Sink: sink, synchronous: true})
+	defer r.Close(ctx)
+
+	// lastLocation returns the location of the last entry received by the
+	// sink.
+	lastLocation := func() string {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		if len(sink.entries) == 0 {
+			return ""
+		}
+		return sink.entries[len(sink.entries)-1].GetLogLocation()
+	}
+	// want returns the location of the line before the caller.
+	want := func() string {
+		_, _, line, _ := runtime.Caller(1)
+		return fmt.Sprintf("logging/logging_test.go:%v", line-1)
+	}
+
+	helpers := map[string]func(context.Context, ...interface{}){
+		"Trace": log.Trace, "Traceln": log.Traceln,
+		"Debug": log.Debug, "Debugln": log.Debugln,
+		"Info": log.Info, "Infoln": log.Infoln,
+		"Notice": log.Notice, "Noticeln": log.Noticeln,
+		"Warn": log.Warn, "Warnln": log.Warnln,
+		"Error": log.Error, "Errorln": log.Errorln,
+	}
+	for name, fn := range helpers {
+		fn(ctx, "msg")
+		if got, want := lastLocation(), want(); got != want {
+			t.Errorf("%v logged at %q, want %q", name, got, want)
+		}
+	}
+
+	formatHelpers := map[string]func(context.Context, string, ...interface{}){
+		"Tracef": log.Tracef, "Debugf": log.Debugf, "Infof": log.Infof,
+		"Noticef": log.Noticef, "Warnf": log.Warnf, "Errorf": log.Errorf,
+	}
+	for name, fn := range formatHelpers {
+		fn(ctx, "msg %v", 1)
+		if got, want := lastLocation(), want(); got != want {
+			t.Errorf("%v logged at %q, want %q", name, got, want)
+		}
+	}
+
+	// The fatal helpers panic once the entry is logged.
+	fatalHelpers := map[string]func(context.Context, ...interface{}){
+		"Fatal": log.Fatal, "Fatalln": log.Fatalln,
+	}
+	for name, fn := range fatalHelpers {
+		var line int
+		func() {
+			defer func() { recover() }()
+			_, _, line, _ = runtime.Caller(0)
+			fn(ctx, "msg")
+		}()
+		if got, want := lastLocation(), fmt.Sprintf("logging/logging_test.go:%v", line+1); got != want {
+			t.Errorf("%v logged at %q, want %q", name, got, want)
+		}
+	}
+	var line int
+	func() {
+		defer func() { recover() }()
+		_, _, line, _ = runtime.Caller(0)
+		log.Fatalf(ctx, "msg %v", 1)
+	}()
+	if got, want := lastLocation(), fmt.Sprintf("logging/logging_test.go:%v", line+1); got != want {
+		t.Errorf("Fatalf logged at %q, want %q", got, want)
+	}
+}
+
+// logOnBehalf logs on behalf of its caller, one level of wrapping.
+func logOnBehalf(ctx context.Context, msg string) {
+	log.Output(ctx, log.SevInfo, 2, msg)
+}
+
+// logOnBehalfTwice logs on behalf of its caller, through another helper.
+func logOnBehalfTwice(ctx context.Context, msg string) {
+	logOnBehalfOf(ctx, msg)
+}
+
+func logOnBehalfOf(ctx context.Context, msg string) {
+	log.Output(ctx, log.SevInfo, 3, msg)
+}
+
+// logWith logs directly with the logger, on behalf of its caller.
+func logWith(ctx context.Context, l log.Logger, msg string) {
+	l.Log(ctx, log.SevInfo, 1, msg)
+}
+
+func TestLogCalldepth(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, synchronous: true})
+	defer r.Close(ctx)
+
+	// Each test logs from its own line, the first of which is 5 lines below.
+	_, _, line, _ := runtime.Caller(0)
+	tests := []struct {
+		name string
+		log  func()
+	}{
+		{"direct", func() { log.Output(ctx, log.SevInfo, 1, "msg") }},
+		{"one level", func() { logOnBehalf(ctx, "msg") }},
+		{"two levels", func() { logOnBehalfTwice(ctx, "msg") }},
+		{"skip", func() { logWith(ctx, log.Skip(r.logger, 1), "msg") }},
+	}
+	for i, test := range tests {
+		want := fmt.Sprintf("logging/logging_test.go:%v", line+5+i)
+		test.log()
+
+		sink.mu.Lock()
+		got := sink.entries[len(sink.entries)-1].GetLogLocation()
+		sink.mu.Unlock()
+		if got != want {
+			t.Errorf("%v: logged at %q, want %q", test.name, got, want)
+		}
+	}
+}
+
+func BenchmarkLog(b *testing.B) {
+	for _, omit := range []bool{false, true} {
+		b.Run(fmt.Sprintf("omitLocation=%v", omit), func(b *testing.B) {
+			buf := make(chan *pb.LogEntry, 1)
+			l := &logger{out: buf, stats: &logStats{}, omitLocation: omit}
+
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				l.Log(ctx, log.SevInfo, 1, "msg")
+				releaseEntry(<-buf) // as the writer does once the entry is sent
+			}
+		})
+	}
+}
+
+func TestRemoteLogging(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{})
+	defer r.Close(ctx)
+
+	for i := 0; i < 3; i++ {
+		log.Infof(ctx, "test message %v", i)
+	}
+	fctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := log.Flush(fctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// Flush only guarantees the entries were handed to the stream.
+	entries := srv.WaitForEntries(t, "test message", 3)
+	if len(entries) != 3 {
+		t.Fatalf("received %v entries, want 3: %v", len(entries), entries)
+	}
+	for i, e := range entries {
+		if got, want := e.GetMessage(), fmt.Sprintf("test message %v", i); got != want {
+			t.Errorf("entry %v = %q, want %q", i, got, want)
+		}
+		if !strings.Contains(e.GetLogLocation(), "logging_test.go:") {
+			t.Errorf("entry %v LogLocation = %q, want logging_test.go", i, e.GetLogLocation())
+		}
+	}
+}
+
+func TestRemoteLoggingOrder(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{})
+	defer r.Close(ctx)
+
+	// More entries than fit in one batch, interleaving both severity classes.
+	const n = 5 * defaultBatchSize
+	for i := 0; i < n; i++ {
+		if i%3 == 0 {
+			log.Warnf(ctx, "ordered warn %v", i)
+		} else {
+			log.Infof(ctx, "ordered info %v", i)
+		}
+	}
+	fctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := log.Flush(fctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	srv.WaitForEntries(t, "ordered", n)
+
+	for _, class := range []string{"ordered warn", "ordered info"} {
+		assertOrdered(t, srv.Entries(class))
+	}
+}
+
+func TestRemoteLoggingReusesConnection(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+	srv.failStreams = 1
+
+	var dials int32
+	prev := grpcx.DialWithOptions
+	grpcx.DialWithOptions = func(ctx context.Context, e string, timeout time.Duration, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+		atomic.AddInt32(&dials, 1)
+		return prev(ctx, e, timeout, opts...)
+	}
+	defer func() { grpcx.DialWithOptions = prev }()
+
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{})
+	defer r.Close(ctx)
+
+	// The first stream fails once the first entry is received, which the
+	// writer notices on the next send.
+	log.Info(ctx, "before the stream failed")
+	srv.WaitForEntries(t, "before", 1)
+	log.Info(ctx, "after the stream failed")
+	srv.WaitForEntries(t, "after", 1)
+
+	if got := atomic.LoadInt32(&dials); got != 1 {
+		t.Errorf("dialed %v times, want the connection reused", got)
+	}
+}
+
+func TestRemoteLoggingStreamClosed(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+	srv.closeStreams = 1
+
+	var out syncBuffer
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{flushInterval: 10 * time.Millisecond, FallbackWriter: &out})
+	defer r.Close(ctx)
+
+	// The runner closes the first stream, which is reestablished right away,
+	// without a reported failure.
+	log.Info(ctx, "before the stream closed")
+	srv.WaitForEntries(t, "before", 1)
+	log.Info(ctx, "after the stream closed")
+	srv.WaitForEntries(t, "after", 1)
+	if got := out.String(); got != "Remote logging stream closed by the runner. Reconnecting ...\n" {
+		t.Errorf("fallback output = %q, want only the reconnect notice", got)
+	}
+}
+
+func TestRemoteLoggingRunnerShutdown(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+	srv.closeStreams = 2
+
+	var out syncBuffer
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{flushInterval: 10 * time.Millisecond, FallbackWriter: &out})
+	defer r.Close(ctx)
+
+	// The runner closes the reestablished stream too, so the writer keeps
+	// reconnecting with backoff, rather than giving up on the runner.
+	log.Info(ctx, "first")
+	srv.WaitForEntries(t, "first", 1)
+	log.Info(ctx, "second")
+	srv.WaitForEntries(t, "second", 1)
+	log.Info(ctx, "third")
+	srv.WaitForEntries(t, "third", 1)
+	if strings.Contains(out.String(), "third") {
+		t.Errorf("entry written to stderr, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "Retrying in") {
+		t.Errorf("fallback output %q doesn't report the backoff", out.String())
+	}
+}
+
+func TestRemoteLoggingRunnerShutdownMaxRetries(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+	srv.closeStreams = 1
+
+	var out syncBuffer
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{flushInterval: 10 * time.Millisecond, FallbackWriter: &out, maxRetries: 1, dialTimeout: 50 * time.Millisecond})
+	defer r.Close(ctx)
+
+	// The runner closes the stream and goes away, so the writer logs to
+	// stderr once it runs out of retries.
+	log.Info(ctx, "first")
+	srv.WaitForEntries(t, "first", 1)
+	srv.Outage()
+	log.Info(ctx, "second")
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(out.String(), "second") {
+		if time.Now().After(deadline) {
+			t.Fatalf("entry not written to stderr, got %q", out.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "Remote logging gave up") {
+		t.Errorf("fallback output %q doesn't explain giving up", out.String())
+	}
+}
+
+func TestRemoteLoggingAnnounced(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+	srv.failStreams = 1
+
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{})
+	defer r.Close(ctx)
+
+	want := "Remote logging established to " + endpoint
+	entries := srv.WaitForEntries(t, "Remote logging established", 1)
+	if got := entries[0].GetMessage(); got != want {
+		t.Errorf("announcement = %q, want %q", got, want)
+	}
+
+	// The stream fails once the announcement is received, and is then
+	// reestablished without another announcement.
+	log.Info(ctx, "after the stream failed")
+	srv.WaitForEntries(t, "after", 1)
+	if got := srv.Entries("Remote logging established"); len(got) != 1 {
+		t.Errorf("received %v announcements, want 1", len(got))
+	}
+}
+
+func TestRemoteLoggingReconnect(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	var out syncBuffer
+	buf := make(chan *pb.LogEntry, 100)
+	w := &remoteWriter{
+		buffer:        buf,
+		priority:      make(chan *pb.LogEntry, 10),
+		flushes:       make(chan chan error),
+		stats:         &logStats{},
+		endpoint:      endpoint,
+		batchSize:     defaultBatchSize,
+		flushInterval: time.Millisecond,
+		dialTimeout:   50 * time.Millisecond,
+		backoffBase:   10 * time.Millisecond,
+		backoffMax:    50 * time.Millisecond,
+		stderr:        &out,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	buf <- newEntry(time.Now(), pb.LogEntry_Severity_INFO, "before the outage")
+	srv.WaitForEntries(t, "before", 1)
+
+	// The connection is dropped. Entries sent before the writer notices may
+	// be lost, so the outage is probed until the failure is reported.
+	restore := srv.Outage()
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(out.String(), "Remote logging failed") {
+		if time.Now().After(deadline) {
+			t.Fatalf("no failure written to stderr, got %q", out.String())
+		}
+		select {
+		case buf <- newEntry(time.Now(), pb.LogEntry_Severity_INFO, "probe"):
+		default:
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The writer keeps reconnecting with backoff, while the entries of the
+	// outage are buffered, and delivers them in order once the server is
+	// back.
+	const n = 10
+	for i := 0; i < n; i++ {
+		buf <- newEntry(time.Now(), pb.LogEntry_Severity_INFO, fmt.Sprintf("during the outage %v", i))
+	}
+	time.Sleep(50 * time.Millisecond)
+	restore()
+
+	entries := srv.WaitForEntries(t, "during the outage", n)
+	if len(entries) != n {
+		t.Errorf("received %v entries of the outage, want %v", len(entries), n)
+	}
+	assertOrdered(t, entries)
+}
+
+func TestRemoteWriterBufferClosed(t *testing.T) {
+	sink := &collectSink{}
+	buf := make(chan *pb.LogEntry, 10)
+	priority := make(chan *pb.LogEntry, 10)
+	w := &remoteWriter{
+		buffer:        buf,
+		priority:      priority,
+		flushes:       make(chan chan error),
+		stats:         &logStats{},
+		sink:          sink,
+		batchSize:     defaultBatchSize,
+		flushInterval: time.Hour,
+		backoffBase:   time.Hour,
+	}
+	buf <- newEntry(time.Now(), pb.LogEntry_Severity_INFO, "info")
+	priority <- newEntry(time.Now(), pb.LogEntry_Severity_WARN, "warn")
+	close(buf)
+
+	done := make(chan error, 1)
+	go func() { done <- w.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil once the buffer is closed", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run didn't return once the buffer was closed")
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != 2 {
+		t.Errorf("sink received %v, want the remaining 2 entries", sink.entries)
+	}
+}
+
+// listSink is a Sink that records the lists it receives.
+type listSink struct {
+	lists []*pb.LogEntry_List
+}
+
+func (s *listSink) Send(list *pb.LogEntry_List) error {
+	s.lists = append(s.lists, &pb.LogEntry_List{LogEntries: append([]*pb.LogEntry(nil), list.GetLogEntries()...)})
+	return nil
+}
+
+func TestSendMaxBatchBytes(t *testing.T) {
+	newBatch := func(sizes ...int) []*pb.LogEntry {
+		var batch []*pb.LogEntry
+		for _, n := range sizes {
+			batch = append(batch, newEntry(time.Unix(0, 0), pb.LogEntry_Severity_INFO, strings.Repeat("x", n)))
+		}
+		return batch
+	}
+	// Entries of the same sizes pack exactly three to a list.
+	entrySize := listEntrySize(newBatch(100)[0])
+
+	tests := []struct {
+		sizes []int
+		want  []int // entries per list
+	}{
+		{[]int{100, 100, 100, 100, 100, 100, 100}, []int{3, 3, 1}},
+		{[]int{100, 101, 100}, []int{2, 1}},
+		{[]int{100, 10000, 100}, []int{1, 1, 1}},
+		{[]int{10000}, []int{1}},
+	}
+	for _, test := range tests {
+		sink := &listSink{}
+		w := &remoteWriter{stats: &logStats{}, maxBatchBytes: 3 * entrySize}
+		batch := newBatch(test.sizes...)
+		if err := w.send(sink, batch); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+
+		var got []int
+		for _, list := range sink.lists {
+			if size := proto.Size(list); len(list.GetLogEntries()) > 1 && size > w.maxBatchBytes {
+				t.Errorf("list of %v bytes exceeds the ceiling of %v", size, w.maxBatchBytes)
+			}
+			got = append(got, len(list.GetLogEntries()))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("send(%v) sent lists of %v entries, want %v", test.sizes, got, test.want)
+		}
+	}
+}
+
+func TestLogSinkOrderAcrossFailures(t *testing.T) {
+	sink := &flakySink{failures: 1}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink})
+	defer r.Close(ctx)
+
+	const n = 3 * defaultBatchSize
+	for i := 0; i < n; i++ {
+		log.Infof(ctx, "ordered %v", i)
+	}
+	// A flush fails if the failed send is part of it, but a later one
+	// succeeds once the writer has reconnected.
+	deadline := time.Now().Add(10 * time.Second)
+	for r.Flush(ctx) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("flush kept failing after the sink recovered")
+		}
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != n {
+		t.Fatalf("sink received %v entries, want %v", len(sink.entries), n)
+	}
+	assertOrdered(t, sink.entries)
+}
+
+// flakySink is a collectSink whose first sends fail.
+type flakySink struct {
+	collectSink
+	failures int
+}
+
+func (s *flakySink) Send(list *pb.LogEntry_List) error {
+	s.mu.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mu.Unlock()
+		return fmt.Errorf("transient failure")
+	}
+	s.mu.Unlock()
+	return s.collectSink.Send(list)
+}
+
+// assertOrdered checks that the entries, whose messages end with a sequence
+// number, are in increasing order.
+func assertOrdered(t *testing.T, entries []*pb.LogEntry) {
+	t.Helper()
+	prev := -1
+	for _, e := range entries {
+		msg := e.GetMessage()
+		i, err := strconv.Atoi(msg[strings.LastIndexByte(msg, ' ')+1:])
+		if err != nil {
+			t.Fatalf("entry %q has no sequence number", msg)
+		}
+		if i <= prev {
+			t.Fatalf("entry %q received after entry %v", msg, prev)
+		}
+		prev = i
+	}
+}
+
+func TestRemoteLoggingCompress(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{compress: true})
+	defer r.Close(ctx)
+
+	log.Info(ctx, "compressed message")
+	entries := srv.WaitForEntries(t, "compressed message", 1)
+	if len(entries) != 1 {
+		t.Errorf("received %v entries, want 1: %v", len(entries), entries)
+	}
+}
+
+func TestLogWorkerFields(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := grpcx.WriteWorkerID(context.Background(), "worker-1")
+	r := Start(ctx, "", Options{Sink: sink})
+	log.Info(ctx, "msg")
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	host, _ := os.Hostname()
+	want := appendFields("msg", log.Fields{"worker_id": "worker-1", "hostname": host})
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != 1 || sink.entries[0].GetMessage() != want {
+		t.Errorf("sink received %v, want a single entry %q", sink.entries, want)
+	}
+}
+
+func TestLogWorkerFieldsMetadata(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	ctx := grpcx.WriteWorkerID(context.Background(), "worker-1")
+	r := Start(ctx, endpoint, Options{labelFields: log.Fields{"job_name": "my jöb"}, omitMessageFields: true})
+	defer r.Close(ctx)
+
+	// The fields are sent with the stream, and left out of the messages.
+	log.Info(ctx, "msg")
+	if got := srv.WaitForEntries(t, "msg", 1)[0].GetMessage(); got != "msg" {
+		t.Errorf("message = %q, want %q", got, "msg")
+	}
+	md := srv.Metadata()[0]
+	host, _ := os.Hostname()
+	want := map[string]string{
+		"beam-log-worker_id": "worker-1",
+		"beam-log-hostname":  host,
+		"beam-log-job_name":  strconv.QuoteToASCII("my jöb"),
+	}
+	for k, v := range want {
+		if got := md.Get(k); len(got) != 1 || got[0] != v {
+			t.Errorf("stream metadata %v = %q, want %q", k, got, v)
+		}
+	}
+}
+
+// collectSink is a Sink that collects the entries sent to it.
+type collectSink struct {
+	mu      sync.Mutex
+	entries []*pb.LogEntry
+}
+
+func (s *collectSink) Send(list *pb.LogEntry_List) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, list.GetLogEntries()...)
+	return nil
+}
+
+func TestLogSink(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink})
+	log.Info(ctx, "to the sink")
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != 1 || sink.entries[0].GetMessage() != "to the sink" {
+		t.Errorf("sink received %v, want a single entry %q", sink.entries, "to the sink")
+	}
+}
+
+func TestLogSynchronous(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, synchronous: true})
+	defer r.Close(ctx)
+
+	for i := 1; i <= 3; i++ {
+		log.Infof(ctx, "entry %v", i)
+
+		// The entry is sent before the call returns.
+		sink.mu.Lock()
+		n := len(sink.entries)
+		sink.mu.Unlock()
+		if n != i {
+			t.Fatalf("sink received %v entries after logging %v, want %v", n, i, i)
+		}
+	}
+}
+
+func TestLogSynchronousSlowAccept(t *testing.T) {
+	srv, _, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	// The server takes a while to accept each connection.
+	slow := grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		time.Sleep(100 * time.Millisecond)
+		srv.mu.Lock()
+		lis := srv.lis
+		srv.mu.Unlock()
+		return lis.Dial()
+	})
+	fallback := &syncBuffer{}
+
+	ctx := context.Background()
+	r := Start(ctx, "bufconn:slow", Options{
+		synchronous:    true,
+		DialOptions:    []grpc.DialOption{grpc.WithInsecure(), slow},
+		FallbackWriter: fallback,
+	})
+	defer r.Close(ctx)
+
+	// The writer doesn't wait on the entries it logs while connecting.
+	start := time.Now()
+	log.Info(ctx, "first")
+	if elapsed := time.Since(start); elapsed >= syncFlushTimeout/2 {
+		t.Errorf("first synchronous Log took %v, want less than %v", elapsed, syncFlushTimeout/2)
+	}
+	log.Info(ctx, "second")
+
+	// The entries are sent once Log returns, but not necessarily received.
+	srv.WaitForEntries(t, "second", 1)
+	var got []string
+	for _, e := range srv.Entries("") {
+		if strings.HasPrefix(e.GetMessage(), "Remote logging established") {
+			continue
+		}
+		got = append(got, e.GetMessage())
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+	if out := fallback.String(); strings.Contains(out, "first") || strings.Contains(out, "second") {
+		t.Errorf("entries written to stderr after being sent: %q", out)
+	}
+}
+
+func TestLogSynchronousFromWriter(t *testing.T) {
+	sink := &blockingSink{unblock: make(chan struct{})}
+	defer close(sink.unblock)
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, synchronous: true, FallbackWriter: &syncBuffer{}})
+	defer func() {
+		cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		r.Close(cctx)
+	}()
+
+	// An entry logged by a writer, whose sink is stuck, isn't waited for.
+	start := time.Now()
+	log.Info(context.WithValue(ctx, writerKey, true), "from the writer")
+	if elapsed := time.Since(start); elapsed >= syncFlushTimeout/2 {
+		t.Errorf("Log from the writer took %v, want less than %v", elapsed, syncFlushTimeout/2)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink})
+	log.Info(ctx, "before drain")
+	if err := r.Drain(ctx); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	// Entries logged after Drain don't reach the sink.
+	r.Log(ctx, log.SevInfo, 0, "after drain")
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != 1 || sink.entries[0].GetMessage() != "before drain" {
+		t.Errorf("sink received %v, want a single entry %q", sink.entries, "before drain")
+	}
+}
+
+func TestRemoteLoggingReplaced(t *testing.T) {
+	first, second := &collectSink{}, &collectSink{}
+
+	ctx := context.Background()
+	prev := log.GetLogger()
+	r1 := Start(ctx, "", Options{Sink: first})
+	log.Info(ctx, "first")
+	// Remote logging is set up again without closing it.
+	r2 := Start(ctx, "", Options{Sink: second})
+	select {
+	case <-r1.Done():
+	default:
+		t.Fatal("writer of the replaced remote logging still running")
+	}
+	log.Info(ctx, "second")
+
+	// Closing the replaced handle doesn't restore the logger it replaced.
+	if err := r1.Close(ctx); err != nil {
+		t.Fatalf("Close of the replaced remote logging failed: %v", err)
+	}
+	if log.GetLogger() != r2.logger {
+		t.Error("closing the replaced remote logging restored the logger it replaced")
+	}
+	if err := r2.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if log.GetLogger() != prev {
+		t.Error("Close didn't restore the logger installed before remote logging")
+	}
+
+	for _, test := range []struct {
+		sink *collectSink
+		want string
+	}{{first, "first"}, {second, "second"}} {
+		test.sink.mu.Lock()
+		if len(test.sink.entries) != 1 || test.sink.entries[0].GetMessage() != test.want {
+			t.Errorf("sink received %v, want a single entry %q", test.sink.entries, test.want)
+		}
+		test.sink.mu.Unlock()
+	}
+}
+
+func TestRemoteLoggingConcurrentSetup(t *testing.T) {
+	ctx := context.Background()
+	prev := log.GetLogger()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := Start(ctx, "", Options{Sink: &collectSink{}})
+			log.Info(ctx, "entry")
+			r.Close(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if log.GetLogger() != prev {
+		t.Error("Close didn't restore the logger installed before remote logging")
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	sink := &blockingSink{unblock: make(chan struct{})}
+	defer close(sink.unblock)
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink})
+	for i := 0; i < 3*defaultBatchSize; i++ {
+		log.Infof(ctx, "stuck %v", i)
+	}
+
+	// The writer is stuck sending the first batch, so the others are
+	// written to stderr.
+	dctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := r.Drain(dctx); err == nil {
+		t.Fatal("Drain succeeded with a stalled sink")
+	}
+	if got := r.Dropped(); got < defaultBatchSize {
+		t.Errorf("Dropped() = %v, want at least %v", got, defaultBatchSize)
+	}
+}
+
+// blockingSink is a Sink whose sends block until unblock is closed.
+type blockingSink struct {
+	unblock chan struct{}
+}
+
+func (s *blockingSink) Send(*pb.LogEntry_List) error {
+	<-s.unblock
+	return fmt.Errorf("stream aborted")
+}
+
+func TestSendTimeout(t *testing.T) {
+	sink := &blockingSink{unblock: make(chan struct{})}
+	w := &remoteWriter{
+		sendTimeout:  10 * time.Millisecond,
+		cancelStream: func() { close(sink.unblock) },
+	}
+
+	batch := []*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "msg")}
+	if err := w.send(sink, batch); err == nil {
+		t.Fatal("send on a stalled stream succeeded, want timeout")
+	}
+	if len(w.pending) != 1 || w.pending[0] != batch[0] {
+		t.Errorf("pending = %v, want the timed out batch %v", w.pending, batch)
+	}
+}
+
+// slowSink is a Sink whose sends succeed after a delay.
+type slowSink struct {
+	delay time.Duration
+}
+
+func (s slowSink) Send(*pb.LogEntry_List) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+func TestSendCompletedAtTimeout(t *testing.T) {
+	// The send completes after the timer fired, so the batch was sent,
+	// rather than timed out.
+	w := &remoteWriter{
+		stats:        &logStats{},
+		sendTimeout:  time.Millisecond,
+		cancelStream: func() {},
+	}
+	batch := []*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "msg")}
+	if err := w.send(slowSink{delay: 20 * time.Millisecond}, batch); err != nil {
+		t.Fatalf("send = %v, want it to succeed", err)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("pending = %v, want none, since the batch was sent", w.pending)
+	}
+}
+
+func TestSendRetry(t *testing.T) {
+	w := &remoteWriter{stats: &logStats{}}
+	batch := []*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "msg")}
+
+	// A failed batch is kept until it fails maxSendAttempts times in a row.
+	for i := 1; i < maxSendAttempts; i++ {
+		if err := w.send(failingSink{}, batch); err == nil {
+			t.Fatal("send on a failing sink succeeded")
+		}
+		if len(w.pending) != 1 || w.pending[0] != batch[0] {
+			t.Fatalf("pending after %v attempts = %v, want the failed batch %v", i, w.pending, batch)
+		}
+	}
+	w.send(failingSink{}, w.pending)
+	if len(w.pending) != 0 {
+		t.Errorf("pending after %v attempts = %v, want it dropped", maxSendAttempts, w.pending)
+	}
+	if got := atomic.LoadInt64(&w.stats.dropped); got != 1 {
+		t.Errorf("dropped = %v, want 1", got)
+	}
+
+	// A successful send resets the count.
+	w.send(failingSink{}, batch)
+	if err := w.send(&collectSink{}, w.pending); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if w.sendFailures != 0 {
+		t.Errorf("sendFailures after a successful send = %v, want 0", w.sendFailures)
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		ok       bool
+	}{
+		{"localhost:12345", true},
+		{"[::1]:12345", true},
+		{"dns:///logging.example.com:443", true},
+		{"unix:///run/beam/logging.sock", true},
+		{"unix://", false},
+		{"", false},
+		{"  ", false},
+		{"localhost", false},
+		{"local host:12345", false},
+	}
+	for _, test := range tests {
+		if err := validateEndpoint(test.endpoint); (err == nil) != test.ok {
+			t.Errorf("validateEndpoint(%q) = %v, want ok %v", test.endpoint, err, test.ok)
+		}
+	}
+}
+
+func TestRemoteLoggingUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logging.sock")
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("can't listen on a Unix domain socket: %v", err)
+	}
+	srv := &fakeLoggingServer{received: make(chan struct{}, 1)}
+	gs := grpc.NewServer()
+	pb.RegisterBeamFnLoggingServer(gs, srv)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	ctx := context.Background()
+	r := Start(ctx, "unix://"+path, Options{})
+	defer r.Close(ctx)
+
+	log.Info(ctx, "over a unix socket")
+	srv.WaitForEntries(t, "over a unix socket", 1)
+}
+
+func TestLoggingDialOptions(t *testing.T) {
+	srv, _, stop := startFakeLoggingServer(t)
+	defer stop()
+
+	// The endpoint isn't redirected by grpcx.DialWithOptions, so it can only
+	// be reached with the dial options.
+	ctx := context.Background()
+	opts := Options{DialOptions: []grpc.DialOption{grpc.WithInsecure(), srv.Dialer()}}
+	r := Start(ctx, "bufconn:direct", opts)
+	defer r.Close(ctx)
+
+	log.Info(ctx, "dialed with options")
+	srv.WaitForEntries(t, "dialed with options", 1)
+}
+
+func TestLogSinks(t *testing.T) {
+	sink, tee := &collectSink{}, &collectSink{}
+	stalled := &blockingSink{unblock: make(chan struct{})}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, Sinks: []Sink{stalled, tee}})
+	log.Info(ctx, "to all sinks")
+
+	// A stalled sink doesn't hold up the others.
+	fctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := r.logger.flush(fctx); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if err := r.tees[1].Flush(fctx); err != nil {
+		t.Fatalf("Flush of tee failed: %v", err)
+	}
+	for name, s := range map[string]*collectSink{"sink": sink, "tee": tee} {
+		s.mu.Lock()
+		if len(s.entries) != 1 || s.entries[0].GetMessage() != "to all sinks" {
+			t.Errorf("%v received %v, want a single entry %q", name, s.entries, "to all sinks")
+		}
+		s.mu.Unlock()
+	}
+
+	close(stalled.unblock)
+	r.Close(ctx)
+}
+
+func TestLogTrace(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 2)
+	l := &logger{out: buf, stats: &logStats{}}
+
+	l.setLevel(log.SevDebug)
+	l.Log(context.Background(), log.SevTrace, 0, "filtered out")
+	if len(buf) != 0 {
+		t.Fatalf("trace entry logged at debug level")
+	}
+
+	l.setLevel(log.SevTrace)
+	l.Log(context.Background(), log.SevTrace, 0, "msg")
+	if got, want := (<-buf).GetSeverity(), pb.LogEntry_Severity_TRACE; got != want {
+		t.Errorf("Severity = %v, want %v", got, want)
+	}
+}
+
+func TestLogLazy(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	// The recorder would keep the debug entry, and so compute it.
+	r := Start(ctx, "", Options{Level: log.SevInfo, Sink: sink, recorderSize: -1})
+	defer r.Close(ctx)
+
+	var calls int
+	msg := log.Lazy(func() string {
+		calls++
+		return "lazy"
+	})
+	log.Debug(ctx, msg)
+	if calls != 0 {
+		t.Errorf("message of a filtered out entry computed %v times", calls)
+	}
+	log.Infof(ctx, "%v message", msg)
+	if calls != 1 {
+		t.Errorf("message of a logged entry computed %v times, want 1", calls)
+	}
+}
+
+func TestLogTimeOp(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := log.WithInstructionID(context.Background(), "inst")
+	r := Start(ctx, "", Options{Sink: sink})
+	func() {
+		defer log.TimeOp(ctx, "timed op")()
+		time.Sleep(10 * time.Millisecond)
+	}()
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != 1 {
+		t.Fatalf("sink received %v, want a single entry", sink.entries)
+	}
+	entry := sink.entries[0]
+	msg := strings.TrimPrefix(entry.GetMessage(), "timed op duration=")
+	if d, err := time.ParseDuration(msg); err != nil || d < 10*time.Millisecond {
+		t.Errorf("message = %q, want the operation with its duration of at least 10ms", entry.GetMessage())
+	}
+	if got := entry.GetInstructionReference(); got != "inst" {
+		t.Errorf("InstructionReference = %q, want %q", got, "inst")
+	}
+	if !strings.Contains(entry.GetLogLocation(), "logging_test.go:") {
+		t.Errorf("LogLocation = %q, want logging_test.go", entry.GetLogLocation())
+	}
+}
+
+func TestLogEventTime(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	et := time.Date(2019, 6, 7, 8, 9, 10, 11, time.UTC)
+	ctx := context.Background()
+	etctx := log.WithEventTime(ctx, et)
+
+	tests := []struct {
+		eventTime bool
+		ctx       context.Context
+		want      time.Time
+	}{
+		{false, etctx, now},
+		{true, etctx, et},
+		{true, ctx, now},
+	}
+	for _, test := range tests {
+		buf := make(chan *pb.LogEntry, 1)
+		l := &logger{out: buf, stats: &logStats{}, now: func() time.Time { return now }, eventTime: test.eventTime}
+		l.Log(test.ctx, log.SevInfo, 1, "msg")
+		if got, _ := ptypes.Timestamp((<-buf).GetTimestamp()); !got.Equal(test.want) {
+			t.Errorf("timestamp with eventTime %v = %v, want %v", test.eventTime, got, test.want)
+		}
+	}
+
+	// The event time is carried over to detached contexts.
+	if got, ok := log.EventTime(log.CopyContextMetadata(etctx, ctx)); !ok || !got.Equal(et) {
+		t.Errorf("EventTime of copied context = %v, %v, want %v", got, ok, et)
+	}
+}
+
+func TestLogNotice(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 2)
+	l := &logger{out: buf, stats: &logStats{}}
+
+	// Notice is between info and warn.
+	l.setLevel(log.SevNotice)
+	l.Log(context.Background(), log.SevInfo, 0, "filtered out")
+	l.Log(context.Background(), log.SevNotice, 0, "msg")
+	if len(buf) != 1 {
+		t.Fatalf("logged %v entries, want 1", len(buf))
+	}
+	if got := (<-buf).GetSeverity(); got != pb.LogEntry_Severity_NOTICE {
+		t.Errorf("severity = %v, want NOTICE", got)
+	}
+}
+
+func TestRemoteLoggingControl(t *testing.T) {
+	srv, endpoint, stop := startFakeLoggingServer(t)
+	defer stop()
+	srv.mu.Lock()
+	srv.controls = []*pb.LogControl{{}, {}}
+	srv.mu.Unlock()
+
+	ctx := context.Background()
+	r := Start(ctx, endpoint, Options{})
+	defer r.Close(ctx)
+
+	// Control messages are received while logging continues.
+	log.Info(ctx, "after control")
+	srv.WaitForEntries(t, "after control", 1)
+}
+
+func TestLogStackTrace(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	l := &logger{out: buf, stats: &logStats{}, traceLevel: log.SevError, maxTraceSize: 1 << 10}
+
+	l.Log(context.Background(), log.SevWarn, 0, "msg")
+	if got := (<-buf).GetTrace(); got != "" {
+		t.Errorf("Trace of warning = %q, want none", got)
+	}
+
+	l.Log(context.Background(), log.SevError, 0, "msg")
+	trace := (<-buf).GetTrace()
+	if !strings.Contains(trace, "TestLogStackTrace") {
+		t.Errorf("Trace of error = %q, want the test function", trace)
+	}
+	if len(trace) > 1<<10 {
+		t.Errorf("Trace of error is %v bytes, want at most %v", len(trace), 1<<10)
+	}
+}
+
+func TestCopyContextMetadata(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	l := &logger{out: buf, stats: &logStats{}, omitLocation: true}
+
+	parent := WithThreadID(metrics.SetPTransformID(log.WithInstructionID(context.Background(), "inst1"), "ptransform1"), "bundle-1")
+	parent = log.WithFields(parent, log.Fields{"key": "value"})
+	l.Log(log.CopyContextMetadata(parent, context.Background()), log.SevInfo, 0, "msg")
+
+	entry := <-buf
+	if got, want := entry.GetInstructionReference(), "inst1"; got != want {
+		t.Errorf("InstructionReference = %q, want %q", got, want)
+	}
+	if got, want := entry.GetPrimitiveTransformReference(), "ptransform1"; got != want {
+		t.Errorf("PrimitiveTransformReference = %q, want %q", got, want)
+	}
+	if got, want := entry.GetThread(), "bundle-1"; got != want {
+		t.Errorf("Thread = %q, want %q", got, want)
+	}
+	if got, want := entry.GetMessage(), "msg key=value"; got != want {
+		t.Errorf("Message = %q, want %q", got, want)
+	}
+}
+
+func TestInstructionID(t *testing.T) {
+	if id, ok := log.InstructionID(context.Background()); ok {
+		t.Errorf("InstructionID(background) = %q, want none", id)
+	}
+	if id, ok := log.InstructionID(log.WithInstructionID(context.Background(), "inst1")); !ok || id != "inst1" {
+		t.Errorf("InstructionID(log.WithInstructionID(inst1)) = %q, %v, want %q", id, ok, "inst1")
+	}
+}
+
+func TestLogEntriesHook(t *testing.T) {
+	var got []int
+	w := &remoteWriter{hooks: []EntriesHook{func(list *pb.LogEntry_List) {
+		got = append(got, len(list.GetLogEntries()))
+	}}}
+
+	batch := []*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "msg")}
+	if err := w.send(&collectSink{}, batch); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(got) != 1 || got[0] != 1 {
+		t.Errorf("hook called with batches of %v entries, want [1]", got)
+	}
+}
@@ -0,0 +1,152 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/core/metrics"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+const (
+	// loggingMetricsNamespace is the namespace of the metrics describing the
+	// state of remote logging.
+	loggingMetricsNamespace = "beam.harness.logging"
+
+	// loggingMetricsBundle and loggingMetricsTransform are the IDs under
+	// which the logging metrics are stored. They aren't tied to a bundle,
+	// since the logging stream outlives all of them.
+	loggingMetricsBundle    = "harness"
+	loggingMetricsTransform = "logging"
+)
+
+var (
+	// loggingMetricsCtx is the context with which the logging metrics are
+	// recorded.
+	loggingMetricsCtx = metrics.SetPTransformID(metrics.SetBundleID(context.Background(), loggingMetricsBundle), loggingMetricsTransform)
+
+	// loggingConnected is 1 while entries are being written to the logging
+	// stream, or sink, and 0 otherwise.
+	loggingConnected = metrics.NewGauge(loggingMetricsNamespace, "connected")
+	// loggingReconnects counts the attempts to reestablish the logging stream
+	// after it failed.
+	loggingReconnects = metrics.NewCounter(loggingMetricsNamespace, "reconnects")
+	// loggingSends and loggingSendFailures count the batches of log entries
+	// that were sent, or failed to be sent.
+	loggingSends        = metrics.NewCounter(loggingMetricsNamespace, "sends")
+	loggingSendFailures = metrics.NewCounter(loggingMetricsNamespace, "send_failures")
+	// loggingBatchSize is the distribution of the number of entries in the
+	// batches sent, and loggingSendLatency that of the time each send took,
+	// in microseconds, which show whether the batching settings, such as
+	// the flush interval, make for efficient sends.
+	loggingBatchSize   = metrics.NewDistribution(loggingMetricsNamespace, "batch_size")
+	loggingSendLatency = metrics.NewDistribution(loggingMetricsNamespace, "send_latency_micros")
+	// loggingDropped counts the log entries dropped due to buffer pressure,
+	// or after repeatedly failing to be sent.
+	loggingDropped = metrics.NewCounter(loggingMetricsNamespace, "dropped")
+	// loggingBufferHighWater is the largest number of log entries buffered
+	// at once so far.
+	loggingBufferHighWater = metrics.NewGauge(loggingMetricsNamespace, "buffer_high_water")
+	// loggingBufferDepth is the number of log entries buffered, as sampled
+	// periodically. A depth close to the buffer size for long signals that
+	// logging outpaces the writer, and that the worker may need to scale,
+	// or log less.
+	loggingBufferDepth = metrics.NewGauge(loggingMetricsNamespace, "buffer_depth")
+	// loggingBlocked counts the log entries that waited for the writer to
+	// catch up, because the buffer was above its block threshold.
+	loggingBlocked = metrics.NewCounter(loggingMetricsNamespace, "blocked")
+	// loggingMuted counts the log entries suppressed while logging was muted.
+	loggingMuted = metrics.NewCounter(loggingMetricsNamespace, "muted")
+)
+
+// Metrics returns the metrics describing the state of remote logging,
+// such as whether the logging stream is connected, and how many entries were
+// dropped. The counters and distributions are cumulative, since logging was
+// first set up. They aren't part of any bundle, so the changes since the
+// previous bundle are reported along with the metrics of each bundle, by
+// AddMetrics.
+func Metrics() []*pb.Metrics_User {
+	return metrics.ToProto(loggingMetricsBundle, loggingMetricsTransform)
+}
+
+var (
+	// reportedMu guards reported, which holds the cumulative logging metrics
+	// as of the last report, by namespace and name.
+	reportedMu sync.Mutex
+	reported   map[string]*pb.Metrics_User
+)
+
+// AddMetrics adds the logging metrics that changed since the last call
+// to the metrics of a finished bundle, as those of the loggingMetricsTransform
+// pseudo transform. Runners sum the counters and distributions reported for
+// the bundles, so only their changes since the last report are added, which
+// add up to the cumulative values over all bundles. The minimum and maximum of
+// a distribution are those since logging was first set up. Gauges are added
+// as is.
+func AddMetrics(m *pb.Metrics) *pb.Metrics {
+	reportedMu.Lock()
+	defer reportedMu.Unlock()
+
+	var user []*pb.Metrics_User
+	next := make(map[string]*pb.Metrics_User)
+	for _, cur := range Metrics() {
+		key := cur.GetMetricName().GetNamespace() + "/" + cur.GetMetricName().GetName()
+		next[key] = cur
+		prev := reported[key]
+		switch {
+		case cur.GetCounterData() != nil:
+			delta := cur.GetCounterData().GetValue() - prev.GetCounterData().GetValue()
+			if delta == 0 {
+				continue
+			}
+			user = append(user, &pb.Metrics_User{
+				MetricName: cur.GetMetricName(),
+				Data:       &pb.Metrics_User_CounterData_{CounterData: &pb.Metrics_User_CounterData{Value: delta}},
+			})
+		case cur.GetDistributionData() != nil:
+			d, p := cur.GetDistributionData(), prev.GetDistributionData()
+			if d.GetCount() == p.GetCount() {
+				continue
+			}
+			user = append(user, &pb.Metrics_User{
+				MetricName: cur.GetMetricName(),
+				Data: &pb.Metrics_User_DistributionData_{DistributionData: &pb.Metrics_User_DistributionData{
+					Count: d.GetCount() - p.GetCount(),
+					Sum:   d.GetSum() - p.GetSum(),
+					Min:   d.GetMin(),
+					Max:   d.GetMax(),
+				}},
+			})
+		default:
+			user = append(user, cur)
+		}
+	}
+	reported = next
+
+	if len(user) == 0 {
+		return m
+	}
+	if m == nil {
+		m = &pb.Metrics{}
+	}
+	if m.Ptransforms == nil {
+		m.Ptransforms = make(map[string]*pb.Metrics_PTransform)
+	}
+	m.Ptransforms[loggingMetricsTransform] = &pb.Metrics_PTransform{User: user}
+	return m
+}
@@ -0,0 +1,141 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// loggingMetric returns the current value of the named logging metric, or the
+// count of a distribution.
+func loggingMetric(t *testing.T, name string) int64 {
+	t.Helper()
+	for _, m := range Metrics() {
+		if m.GetMetricName().GetName() != name {
+			continue
+		}
+		if c := m.GetCounterData(); c != nil {
+			return c.GetValue()
+		}
+		if d := m.GetDistributionData(); d != nil {
+			return d.GetCount()
+		}
+		return m.GetGaugeData().GetValue()
+	}
+	return 0
+}
+
+// failingSink is a Sink whose sends always fail.
+type failingSink struct{}
+
+func (failingSink) Send(*pb.LogEntry_List) error {
+	return fmt.Errorf("sink unavailable")
+}
+
+func TestMetrics(t *testing.T) {
+	sends, failures := loggingMetric(t, "sends"), loggingMetric(t, "send_failures")
+	batches, latencies := loggingMetric(t, "batch_size"), loggingMetric(t, "send_latency_micros")
+
+	w := &remoteWriter{}
+	batch := []*pb.LogEntry{newEntry(time.Now(), pb.LogEntry_Severity_INFO, "msg")}
+	if err := w.send(&collectSink{}, batch); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if err := w.send(failingSink{}, batch); err == nil {
+		t.Fatal("send on a failing sink succeeded")
+	}
+	if got := loggingMetric(t, "sends"); got != sends+1 {
+		t.Errorf("sends = %v, want %v", got, sends+1)
+	}
+	if got := loggingMetric(t, "send_failures"); got != failures+1 {
+		t.Errorf("send_failures = %v, want %v", got, failures+1)
+	}
+	// Only the successful send is in the distributions.
+	if got := loggingMetric(t, "batch_size"); got != batches+1 {
+		t.Errorf("batch_size count = %v, want %v", got, batches+1)
+	}
+	if got := loggingMetric(t, "send_latency_micros"); got != latencies+1 {
+		t.Errorf("send_latency_micros count = %v, want %v", got, latencies+1)
+	}
+
+	dropped := loggingMetric(t, "dropped")
+	l := &logger{out: make(chan *pb.LogEntry), stats: &logStats{}}
+	l.buffer(0, newEntry(time.Now(), pb.LogEntry_Severity_INFO, "dropped"), true)
+	if got := loggingMetric(t, "dropped"); got != dropped+1 {
+		t.Errorf("dropped = %v, want %v", got, dropped+1)
+	}
+}
+
+func TestMetricsConnected(t *testing.T) {
+	sink := &blockingSink{unblock: make(chan struct{})}
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for loggingMetric(t, "connected") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("connected gauge not set while writing to the sink")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(sink.unblock)
+	r.Close(ctx)
+	if got := loggingMetric(t, "connected"); got != 0 {
+		t.Errorf("connected = %v after Close, want 0", got)
+	}
+}
+
+func TestAddMetrics(t *testing.T) {
+	// The changes until now are reported with an earlier bundle.
+	AddMetrics(nil)
+
+	loggingReconnects.Inc(loggingMetricsCtx, 2)
+	loggingBatchSize.Update(loggingMetricsCtx, 5)
+	m := AddMetrics(&pb.Metrics{})
+	user := map[string]*pb.Metrics_User{}
+	for _, u := range m.GetPtransforms()[loggingMetricsTransform].GetUser() {
+		user[u.GetMetricName().GetName()] = u
+	}
+	if got := user["reconnects"].GetCounterData().GetValue(); got != 2 {
+		t.Errorf("reconnects = %v, want 2", got)
+	}
+	if d := user["batch_size"].GetDistributionData(); d.GetCount() != 1 || d.GetSum() != 5 {
+		t.Errorf("batch_size = %v, want a count of 1 and sum of 5", d)
+	}
+	if _, ok := user["sends"]; ok {
+		t.Errorf("unchanged counter sends reported")
+	}
+
+	// Only the changes since the last report are reported.
+	loggingReconnects.Inc(loggingMetricsCtx, 1)
+	m = AddMetrics(nil)
+	for _, u := range m.GetPtransforms()[loggingMetricsTransform].GetUser() {
+		switch u.GetMetricName().GetName() {
+		case "reconnects":
+			if got := u.GetCounterData().GetValue(); got != 1 {
+				t.Errorf("reconnects = %v, want 1", got)
+			}
+		case "batch_size":
+			t.Errorf("unchanged distribution batch_size reported")
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// Mute stops the remote logging from sending entries to the runner,
+// or any sink, until Unmute is called. Unlike the log level, it is a
+// hard switch for operational incidents, such as a noisy replay: the entries
+// of all severities are suppressed and counted, except fatal ones. It has no
+// effect if remote logging isn't set up.
+func Mute() {
+	if l, ok := log.GetLogger().(*logger); ok {
+		l.mute()
+	}
+}
+
+// Unmute resumes the remote logging muted by Mute, and logs the
+// number of entries suppressed in the meantime.
+func Unmute() {
+	if l, ok := log.GetLogger().(*logger); ok {
+		l.unmute()
+	}
+}
+
+func (l *logger) mute() {
+	atomic.StoreInt32(&l.muted, 1)
+}
+
+func (l *logger) unmute() {
+	if !atomic.CompareAndSwapInt32(&l.muted, 1, 0) {
+		return
+	}
+	n := atomic.SwapInt64(&l.suppressed, 0)
+	l.write(context.Background(), log.SevInfo, newEntry(l.timeNow(), l.severity(log.SevInfo), fmt.Sprintf("Remote logging unmuted. Suppressed %d log entries while muted.", n)))
+}
@@ -0,0 +1,60 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogMute(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 10)
+	l := &logger{out: buf, priority: make(chan *pb.LogEntry, 10), stats: &logStats{}}
+	muted := loggingMetric(t, "muted")
+
+	ctx := context.Background()
+	l.mute()
+	l.Log(ctx, log.SevInfo, 1, "muted info")
+	l.Log(ctx, log.SevError, 1, "muted error")
+	if len(buf) != 0 || len(l.priority) != 0 {
+		t.Fatalf("entries buffered while muted")
+	}
+	if got := loggingMetric(t, "muted"); got != muted+2 {
+		t.Errorf("muted = %v, want %v", got, muted+2)
+	}
+
+	l.unmute()
+	l.Log(ctx, log.SevInfo, 1, "unmuted")
+	if len(buf) != 2 {
+		t.Fatalf("%v entries buffered after unmuting, want 2", len(buf))
+	}
+	want := "Remote logging unmuted. Suppressed 2 log entries while muted."
+	if got := (<-buf).GetMessage(); got != want {
+		t.Errorf("first entry = %q, want %q", got, want)
+	}
+	if got := (<-buf).GetMessage(); got != "unmuted" {
+		t.Errorf("second entry = %q, want %q", got, "unmuted")
+	}
+
+	// Unmuting again has no effect.
+	l.unmute()
+	if len(buf) != 0 {
+		t.Errorf("entry buffered by unmuting twice")
+	}
+}
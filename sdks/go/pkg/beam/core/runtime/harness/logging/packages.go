@@ -0,0 +1,124 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// packageLevels are the minimum severities of entries logged from the packages
+// under given import path prefixes, such as "github.com/me/mypkg", which
+// matches that package and the ones below it. The empty prefix matches all
+// packages. The most specific matching prefix applies.
+type packageLevels struct {
+	// prefixes are ordered from the most to the least specific, along with
+	// their levels.
+	prefixes []string
+	levels   []log.Severity
+	// min is the lowest of the levels.
+	min log.Severity
+	// sites caches the index of the prefix matching each call site, given by
+	// its program counter, or -1 if none does.
+	sites sync.Map
+}
+
+func newPackageLevels(m map[string]log.Severity) *packageLevels {
+	p := &packageLevels{min: log.SevFatal}
+	for prefix := range m {
+		p.prefixes = append(p.prefixes, prefix)
+	}
+	sort.Slice(p.prefixes, func(i, j int) bool {
+		return len(p.prefixes[i]) > len(p.prefixes[j])
+	})
+	for _, prefix := range p.prefixes {
+		sev := m[prefix]
+		p.levels = append(p.levels, sev)
+		if !sev.AtLeast(p.min) {
+			p.min = sev
+		}
+	}
+	return p
+}
+
+// level returns the level of the package of the function at the program
+// counter, and whether any prefix matches it.
+func (p *packageLevels) level(pc uintptr) (log.Severity, bool) {
+	v, ok := p.sites.Load(pc)
+	if !ok {
+		v = p.match(functionPackage(pc))
+		p.sites.Store(pc, v)
+	}
+	if i := v.(int); i >= 0 {
+		return p.levels[i], true
+	}
+	return log.SevUnspecified, false
+}
+
+// match returns the index of the most specific prefix matching the package,
+// or -1 if none does.
+func (p *packageLevels) match(pkg string) int {
+	for i, prefix := range p.prefixes {
+		if prefix == "" || pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			return i
+		}
+	}
+	return -1
+}
+
+// functionPackage returns the import path of the package of the function at
+// the program counter, such as "github.com/me/mypkg" for
+// "github.com/me/mypkg.(*T).Method", or "" if it is unknown.
+func functionPackage(pc uintptr) string {
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	slash := strings.LastIndexByte(name, '/')
+	if dot := strings.IndexByte(name[slash+1:], '.'); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+// ParsePackageLevels parses the worker_log_package_levels pipeline option, a
+// comma-separated list of prefix=level pairs, such as
+// "github.com/me/mypkg=debug,github.com/noisy=warn".
+func ParsePackageLevels(s string) (map[string]log.Severity, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	m := make(map[string]log.Severity)
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.LastIndexByte(pair, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid worker_log_package_levels %q: want prefix=level pairs", s)
+		}
+		level := strings.TrimSpace(pair[i+1:])
+		sev, err := ParseLevel(level)
+		if err != nil || level == "" {
+			return nil, fmt.Errorf("invalid worker_log_package_levels %q: bad level for %q", s, pair[:i])
+		}
+		m[strings.TrimSpace(pair[:i])] = sev
+	}
+	return m, nil
+}
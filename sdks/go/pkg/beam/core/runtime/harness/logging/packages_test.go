@@ -0,0 +1,115 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+const loggingPkg = "github.com/apache/beam/sdks/go/pkg/beam/core/runtime/harness/logging"
+
+func TestFunctionPackage(t *testing.T) {
+	pc, _, _, _ := runtime.Caller(0)
+	if got := functionPackage(pc); got != loggingPkg {
+		t.Errorf("functionPackage() = %q, want %q", got, loggingPkg)
+	}
+	if got := functionPackage(0); got != "" {
+		t.Errorf("functionPackage(0) = %q, want empty", got)
+	}
+}
+
+func TestPackageLevelsMatch(t *testing.T) {
+	p := newPackageLevels(map[string]log.Severity{
+		"":                    log.SevInfo,
+		"github.com/me":       log.SevWarn,
+		"github.com/me/mypkg": log.SevDebug,
+	})
+	tests := []struct {
+		pkg  string
+		want log.Severity
+	}{
+		{"github.com/me/mypkg", log.SevDebug},
+		{"github.com/me/mypkg/sub", log.SevDebug},
+		{"github.com/me/mypkgs", log.SevWarn},
+		{"github.com/me/other", log.SevWarn},
+		{"github.com/you", log.SevInfo},
+	}
+	for _, test := range tests {
+		if got := p.levels[p.match(test.pkg)]; got != test.want {
+			t.Errorf("level of %q = %v, want %v", test.pkg, got, test.want)
+		}
+	}
+	if p.min != log.SevDebug {
+		t.Errorf("min = %v, want %v", p.min, log.SevDebug)
+	}
+}
+
+func TestParsePackageLevels(t *testing.T) {
+	tests := []struct {
+		s    string
+		want map[string]log.Severity
+		err  bool
+	}{
+		{"", nil, false},
+		{"github.com/me/mypkg=debug, github.com/noisy=warn", map[string]log.Severity{
+			"github.com/me/mypkg": log.SevDebug,
+			"github.com/noisy":    log.SevWarn,
+		}, false},
+		{"=error", map[string]log.Severity{"": log.SevError}, false},
+		{"github.com/me", nil, true},
+		{"github.com/me=loud", nil, true},
+		{"github.com/me=", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParsePackageLevels(test.s)
+		if (err != nil) != test.err || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParsePackageLevels(%q) = %v, %v, want %v, error: %v", test.s, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestLogPackageLevels(t *testing.T) {
+	tests := []struct {
+		levels map[string]log.Severity
+		sev    log.Severity
+		logged bool
+	}{
+		{nil, log.SevDebug, false},
+		{map[string]log.Severity{loggingPkg: log.SevDebug}, log.SevDebug, true},
+		{map[string]log.Severity{loggingPkg: log.SevWarn}, log.SevInfo, false},
+		{map[string]log.Severity{"github.com/other": log.SevDebug}, log.SevDebug, false},
+		{map[string]log.Severity{"github.com/other": log.SevDebug}, log.SevInfo, true},
+	}
+	for _, test := range tests {
+		buf := make(chan *pb.LogEntry, 1)
+		l := &logger{out: buf, stats: &logStats{}, omitLocation: true}
+		l.setLevel(log.SevInfo)
+		if test.levels != nil {
+			l.packages = newPackageLevels(test.levels)
+		}
+
+		l.Log(context.Background(), test.sev, 1, "msg")
+		if logged := len(buf) == 1; logged != test.logged {
+			t.Errorf("Log(%v) with levels %v logged: %v, want %v", test.sev, test.levels, logged, test.logged)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultBlockTimeout bounds how long an entry logged while the buffer
+	// is above its block threshold waits for the writer to catch up.
+	defaultBlockTimeout = 10 * time.Millisecond
+	// bufferDepthInterval is how often the number of buffered entries is
+	// sampled into the buffer_depth gauge.
+	bufferDepthInterval = time.Second
+)
+
+// observeFill records the number of entries buffered by the logger, updating
+// its high-water mark if it is a new maximum.
+func (l *logger) observeFill() {
+	n := int64(len(l.out) + len(l.priority))
+	for {
+		hw := atomic.LoadInt64(&l.highWater)
+		if n <= hw || atomic.CompareAndSwapInt64(&l.highWater, hw, n) {
+			return
+		}
+	}
+}
+
+// recordBufferDepth sets the buffer_depth gauge to the number of entries
+// currently buffered by the logger, and the buffer_high_water gauge to its
+// high-water mark.
+func (l *logger) recordBufferDepth() {
+	loggingBufferDepth.Set(loggingMetricsCtx, int64(len(l.out)+len(l.priority)))
+	loggingBufferHighWater.Set(loggingMetricsCtx, atomic.LoadInt64(&l.highWater))
+}
+
+// sampleBufferDepth records the buffer depth and high-water mark every
+// bufferDepthInterval, which is much cheaper than on every entry, until done
+// is closed, once the writer has stopped. Only the logger installed samples
+// them, since the gauges are shared.
+func (l *logger) sampleBufferDepth(done <-chan struct{}) {
+	t := time.NewTicker(bufferDepthInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			l.recordBufferDepth()
+		case <-done:
+			l.recordBufferDepth()
+			return
+		}
+	}
+}
+
+// await waits, for up to blockTimeout, until the regular buffer is below its
+// block threshold, if it is above. The writer signals freed as it takes
+// entries. Once a wait times out, such as because the endpoint is
+// unreachable, the logger stops waiting until the buffer falls below the
+// threshold again, so that user code isn't slowed down by every entry.
+func (l *logger) await() {
+	if len(l.out) < l.blockThreshold {
+		atomic.StoreInt32(&l.stalled, 0)
+		return
+	}
+	if atomic.LoadInt32(&l.stalled) != 0 {
+		return
+	}
+	loggingBlocked.Inc(loggingMetricsCtx, 1)
+	timeout := time.NewTimer(l.blockTimeout)
+	defer timeout.Stop()
+	for len(l.out) >= l.blockThreshold {
+		select {
+		case <-l.freed:
+		case <-timeout.C:
+			atomic.StoreInt32(&l.stalled, 1)
+			return
+		}
+	}
+	// The writer signals once for any number of waiting entries, so the
+	// next one is woken in turn.
+	signalFreed(l.freed)
+}
+
+// signalFreed wakes an entry waiting in await, if any, without blocking.
+func signalFreed(freed chan struct{}) {
+	select {
+	case freed <- struct{}{}:
+	default:
+	}
+}
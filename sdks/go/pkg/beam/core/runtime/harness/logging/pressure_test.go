@@ -0,0 +1,161 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogBufferHighWater(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1000)
+	l := &logger{out: buf, stats: &logStats{}}
+	for i := 0; i < 500; i++ {
+		l.Log(context.Background(), log.SevInfo, 1, "msg")
+	}
+	for i := 0; i < 100; i++ {
+		<-buf
+	}
+	l.Log(context.Background(), log.SevInfo, 1, "msg")
+	l.recordBufferDepth()
+	if got := loggingMetric(t, "buffer_high_water"); got != 500 {
+		t.Errorf("buffer_high_water = %v, want 500", got)
+	}
+
+	// Each logger has its own high-water mark.
+	l = &logger{out: make(chan *pb.LogEntry, 10), stats: &logStats{}}
+	l.Log(context.Background(), log.SevInfo, 1, "msg")
+	l.recordBufferDepth()
+	if got := loggingMetric(t, "buffer_high_water"); got != 1 {
+		t.Errorf("buffer_high_water = %v for a new logger, want 1", got)
+	}
+}
+
+func TestLogBufferDepth(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 10)
+	l := &logger{out: buf, priority: make(chan *pb.LogEntry, 10), stats: &logStats{}}
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		l.Log(ctx, log.SevInfo, 1, "msg")
+	}
+	l.Log(ctx, log.SevWarn, 1, "warn")
+	l.recordBufferDepth()
+	if got := loggingMetric(t, "buffer_depth"); got != 6 {
+		t.Errorf("buffer_depth = %v, want 6", got)
+	}
+
+	// The depth is sampled once more when the writer stops.
+	<-buf
+	done := make(chan struct{})
+	close(done)
+	l.sampleBufferDepth(done)
+	if got := loggingMetric(t, "buffer_depth"); got != 5 {
+		t.Errorf("buffer_depth = %v, want 5", got)
+	}
+}
+
+func TestLogBlockThreshold(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 4)
+	freed := make(chan struct{}, 1)
+	l := &logger{out: buf, stats: &logStats{}, blockThreshold: 2, blockTimeout: time.Second, freed: freed}
+	ctx := context.Background()
+	l.Log(ctx, log.SevInfo, 1, "msg0")
+	l.Log(ctx, log.SevInfo, 1, "msg1")
+
+	// Above the threshold, the call waits for the writer to take an entry.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-buf
+		signalFreed(freed)
+	}()
+	blocked := loggingMetric(t, "blocked")
+	start := time.Now()
+	l.Log(ctx, log.SevInfo, 1, "msg2")
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Log returned after %v, want it to wait for the writer", elapsed)
+	}
+	if got := loggingMetric(t, "blocked"); got != blocked+1 {
+		t.Errorf("blocked = %v, want %v", got, blocked+1)
+	}
+	if len(buf) != 2 {
+		t.Fatalf("buffered %v entries, want 2", len(buf))
+	}
+}
+
+func TestLogBlockTimeout(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 4)
+	l := &logger{out: buf, stats: &logStats{}, blockThreshold: 1, blockTimeout: 10 * time.Millisecond}
+	ctx := context.Background()
+	l.Log(ctx, log.SevInfo, 1, "msg0")
+
+	// Without a writer, the first call above the threshold times out, and
+	// buffers its entry anyway, while the later ones don't wait at all.
+	start := time.Now()
+	l.Log(ctx, log.SevInfo, 1, "msg1")
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Log returned after %v, want it to wait for the timeout", elapsed)
+	}
+	start = time.Now()
+	l.Log(ctx, log.SevInfo, 1, "msg2")
+	if elapsed := time.Since(start); elapsed >= 10*time.Millisecond {
+		t.Errorf("Log returned after %v, want it not to wait once stalled", elapsed)
+	}
+	if len(buf) != 3 || l.Dropped() != 0 {
+		t.Errorf("buffered %v entries and dropped %v, want 3 and 0", len(buf), l.Dropped())
+	}
+
+	// Once the buffer falls below the threshold, calls wait again.
+	for len(buf) > 0 {
+		<-buf
+	}
+	l.Log(ctx, log.SevInfo, 1, "msg3")
+	if l.stalled != 0 {
+		t.Error("still stalled once the buffer was emptied")
+	}
+}
+
+func TestLogBlockWakesWaiters(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 8)
+	freed := make(chan struct{}, 1)
+	l := &logger{out: buf, stats: &logStats{}, blockThreshold: 2, blockTimeout: 10 * time.Second, freed: freed}
+	ctx := context.Background()
+	l.Log(ctx, log.SevInfo, 1, "msg0")
+	l.Log(ctx, log.SevInfo, 1, "msg1")
+
+	// A single signal wakes every entry waiting once there is room.
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			l.await()
+			done <- struct{}{}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	<-buf
+	<-buf
+	signalFreed(freed)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("entry still waiting once the buffer was emptied")
+		}
+	}
+}
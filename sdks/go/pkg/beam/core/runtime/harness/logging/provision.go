@@ -0,0 +1,104 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/provision"
+)
+
+// provisionTimeout bounds how long setting up logging waits for the
+// provisioning info.
+const provisionTimeout = 10 * time.Second
+
+// defaultProvisionLabels are the provisioning labels attached to entries,
+// unless configured otherwise. They identify the job, and have a single value
+// for all of its workers.
+var defaultProvisionLabels = []string{"job_id", "job_name"}
+
+// getProvisionInfo returns the provisioning info from the endpoint. It is a
+// variable so that tests can fake the provisioning service.
+var getProvisionInfo = provision.Info
+
+// parseProvisionLabels returns the comma-separated labels, or nil if there
+// are none.
+func parseProvisionLabels(s string) []string {
+	var labels []string
+	for _, label := range strings.Split(s, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// provisionFields reads the provisioning info from the endpoint and returns
+// the given labels of it as fields. Labels without a value are left out.
+func provisionFields(ctx context.Context, endpoint string, labels []string) (log.Fields, error) {
+	ctx, cancel := context.WithTimeout(ctx, provisionTimeout)
+	defer cancel()
+	info, err := getProvisionInfo(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provisioning info from %v: %v", endpoint, err)
+	}
+
+	fields := make(log.Fields)
+	for _, label := range labels {
+		if v := provisionLabel(info, label); v != "" {
+			fields[label] = v
+		}
+	}
+	return fields, nil
+}
+
+// provisionLabel returns the value of the label in the provisioning info: the
+// job ID or name, or the string pipeline option of that name. Pipeline options
+// are typically nested under "options".
+func provisionLabel(info *pb.ProvisionInfo, label string) string {
+	switch label {
+	case "job_id":
+		return info.GetJobId()
+	case "job_name":
+		return info.GetJobName()
+	}
+	opts := info.GetPipelineOptions().GetFields()
+	if v, ok := opts["options"].GetStructValue().GetFields()[label]; ok {
+		return v.GetStringValue()
+	}
+	return opts[label].GetStringValue()
+}
+
+// withLabels returns the fields along with the labels, which don't override
+// any of the fields.
+func withLabels(fields, labels log.Fields) log.Fields {
+	if len(labels) == 0 {
+		return fields
+	}
+	merged := make(log.Fields, len(fields)+len(labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,134 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/provision"
+)
+
+func TestParseProvisionLabels(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"job_name", []string{"job_name"}},
+		{" job_name, region ,,", []string{"job_name", "region"}},
+	}
+	for _, test := range tests {
+		if got := parseProvisionLabels(test.s); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseProvisionLabels(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestProvisionLabels(t *testing.T) {
+	opts, err := provision.JSONToProto(`{"options": {"region": "us-central1", "workers": 3}, "zone": "a"}`)
+	if err != nil {
+		t.Fatalf("JSONToProto failed: %v", err)
+	}
+	info := &pb.ProvisionInfo{JobId: "job-1", JobName: "my job", PipelineOptions: opts}
+
+	prev := getProvisionInfo
+	defer func() { getProvisionInfo = prev }()
+	getProvisionInfo = func(ctx context.Context, endpoint string) (*pb.ProvisionInfo, error) {
+		if endpoint != "provision" {
+			t.Errorf("provisioning info read from %q, want %q", endpoint, "provision")
+		}
+		return info, nil
+	}
+
+	sink := &collectSink{}
+	ctx := context.Background()
+	r := Start(ctx, "", Options{
+		Sink:              sink,
+		ProvisionEndpoint: "provision",
+		ProvisionLabels:   []string{"job_name", "region", "zone", "workers", "missing"},
+	})
+	log.Info(ctx, "msg")
+	r.Close(ctx)
+
+	// Only labels with a string value are attached.
+	want := appendFields("msg", log.Fields{"job_name": "my job", "region": "us-central1", "zone": "a"})
+	if len(sink.entries) != 1 || sink.entries[0].GetMessage() != want {
+		t.Errorf("sink received %v, want a single entry %q", sink.entries, want)
+	}
+}
+
+func TestProvisionLabelsUnavailable(t *testing.T) {
+	prev := getProvisionInfo
+	defer func() { getProvisionInfo = prev }()
+	getProvisionInfo = func(ctx context.Context, endpoint string) (*pb.ProvisionInfo, error) {
+		return nil, errors.New("unavailable")
+	}
+
+	sink := &collectSink{}
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: sink, ProvisionEndpoint: "provision"})
+	log.Info(ctx, "msg")
+	r.Close(ctx)
+
+	// The warning may be sent first, as a priority entry.
+	var warned, logged bool
+	for _, e := range sink.entries {
+		warned = warned || strings.HasPrefix(e.GetMessage(), "Not attaching provisioning labels")
+		logged = logged || e.GetMessage() == "msg"
+	}
+	if len(sink.entries) != 2 || !warned || !logged {
+		t.Errorf("sink received %v, want a warning, and the entry without labels", sink.entries)
+	}
+}
+
+func TestProvisionLabelsUnlocked(t *testing.T) {
+	prev := getProvisionInfo
+	defer func() { getProvisionInfo = prev }()
+	reading, unblock := make(chan struct{}), make(chan struct{})
+	getProvisionInfo = func(ctx context.Context, endpoint string) (*pb.ProvisionInfo, error) {
+		close(reading)
+		<-unblock
+		return &pb.ProvisionInfo{JobName: "my job"}, nil
+	}
+
+	ctx := context.Background()
+	done := make(chan *Remote)
+	go func() {
+		done <- Start(ctx, "", Options{Sink: &collectSink{}, ProvisionEndpoint: "provision"})
+	}()
+	<-reading
+
+	// Setting up logging again doesn't wait for the labels being read.
+	set := make(chan struct{})
+	go func() {
+		Start(ctx, "", Options{disabled: true}).Close(ctx)
+		close(set)
+	}()
+	select {
+	case <-set:
+	case <-time.After(5 * time.Second):
+		t.Error("setting up logging waited for the provisioning labels of another setup")
+	}
+	close(unblock)
+	(<-done).Close(ctx)
+}
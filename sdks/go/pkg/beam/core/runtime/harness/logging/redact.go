@@ -0,0 +1,51 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the redacted parts of messages.
+const redacted = "[REDACTED]"
+
+// CompileRedactions returns a single regular expression matching any of the
+// patterns, such as `password=\S+`, for Options.Redact, so that a message is
+// scanned only once, or nil if there are none.
+func CompileRedactions(patterns ...string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	alts := make([]string, len(patterns))
+	for i, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid log redaction %q: %v", p, err)
+		}
+		alts[i] = "(?:" + p + ")"
+	}
+	return regexp.Compile(strings.Join(alts, "|"))
+}
+
+// redact returns the message with the parts matching re replaced, if re is
+// set.
+func redact(re *regexp.Regexp, msg string) string {
+	if re == nil {
+		return msg
+	}
+	return re.ReplaceAllLiteralString(msg, redacted)
+}
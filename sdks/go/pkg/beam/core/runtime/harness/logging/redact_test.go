@@ -0,0 +1,49 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestCompileRedactions(t *testing.T) {
+	if re, err := CompileRedactions(); re != nil || err != nil {
+		t.Errorf("CompileRedactions() = %v, %v, want nil", re, err)
+	}
+	if _, err := CompileRedactions("ok", "(unclosed"); err == nil {
+		t.Error("CompileRedactions with an invalid pattern succeeded")
+	}
+}
+
+func TestLogRedact(t *testing.T) {
+	re, err := CompileRedactions(`password=\S+`, `\d{3}-\d{2}-\d{4}`)
+	if err != nil {
+		t.Fatalf("CompileRedactions failed: %v", err)
+	}
+	buf := make(chan *pb.LogEntry, 1)
+	l := &logger{out: buf, stats: &logStats{}, redact: re}
+
+	ctx := log.WithFields(context.Background(), log.Fields{"ssn": "123-45-6789"})
+	l.Log(ctx, log.SevInfo, 1, "login password=hunter2 ok")
+	want := "login [REDACTED] ok ssn=[REDACTED]"
+	if got := (<-buf).GetMessage(); got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}
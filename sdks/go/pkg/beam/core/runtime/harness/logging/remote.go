@@ -0,0 +1,539 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/util/grpcx"
+)
+
+const (
+	// defaultBufferSize is the capacity of the log buffer, unless
+	// configured otherwise.
+	defaultBufferSize = 2000
+	// defaultBufferBytes is the cap on the approximate total size of the
+	// buffered entries, unless configured otherwise.
+	defaultBufferBytes = 32 << 20
+	// defaultMaxMessageSize is the length in bytes beyond which messages are
+	// truncated, unless configured otherwise.
+	defaultMaxMessageSize = 64 << 10
+	// defaultMaxTraceSize bounds the size of the stack traces attached to
+	// entries, unless configured otherwise.
+	defaultMaxTraceSize = 16 << 10
+	// priorityBufferSize is the capacity of the buffer for entries of WARN
+	// severity or above.
+	priorityBufferSize = 100
+	// defaultBatchSize is the maximum number of entries sent to the FnLogging
+	// service in a single LogEntry_List, unless configured otherwise.
+	defaultBatchSize = 100
+	// defaultFlushInterval is the maximum time a partial batch is held back
+	// waiting for more entries before it is sent.
+	defaultFlushInterval = 500 * time.Millisecond
+	// drainTimeout bounds how long remaining entries are given to be sent
+	// once the harness context is cancelled.
+	drainTimeout = 2 * time.Second
+	// defaultDialTimeout bounds each attempt to connect to the endpoint.
+	defaultDialTimeout = 30 * time.Second
+	// defaultMaxBatchBytes bounds the serialized size of a LogEntry_List,
+	// just under the default 4MB limit of gRPC messages.
+	defaultMaxBatchBytes = 4<<20 - 64<<10
+	// defaultSendTimeout bounds how long a single LogEntry_List may take to
+	// be sent on the stream before it is considered stalled.
+	defaultSendTimeout = 5 * time.Second
+	// defaultKeepaliveTime is the idle time after which the logging
+	// connection is pinged. gRPC servers reject more frequent pings by
+	// default, closing the connection. defaultKeepaliveTimeout is how long
+	// the ping may take before the connection is considered dead.
+	defaultKeepaliveTime    = 5 * time.Minute
+	defaultKeepaliveTimeout = 20 * time.Second
+
+	// signalDrainTimeout bounds how long the buffered entries are flushed
+	// once the worker is asked to terminate, which typically leaves it a
+	// short grace period.
+	signalDrainTimeout = 10 * time.Second
+
+	// maxSendAttempts is the number of consecutive times a batch may fail to
+	// be sent before it is dropped.
+	maxSendAttempts = 3
+
+	// defaultBackoffBase and defaultBackoffMax bound the delay between
+	// reconnect attempts.
+	defaultBackoffBase = 500 * time.Millisecond
+	defaultBackoffMax  = 30 * time.Second
+	// backoffResetAfter is how long a connection must stay up for the
+	// reconnect delay to be reset to its base.
+	backoffResetAfter = 10 * time.Second
+	// failureReportInterval is how often a persistent reconnect failure is
+	// summarized on stderr.
+	failureReportInterval = time.Minute
+	// dropReportInterval is how often the writer reports entries that were
+	// dropped since its last report, if any.
+	dropReportInterval = 10 * time.Second
+)
+
+// Sink is a destination for batches of log entries sent by the harness. The
+// FnLogging client stream is the default Sink. Send is only called from a
+// single goroutine. If Send fails, the batch is reported to stderr and
+// the sink is retried with backoff. If the sink implements io.Closer, it is
+// closed once its writer stops, after the buffered entries are sent.
+type Sink interface {
+	Send(list *pb.LogEntry_List) error
+}
+
+// EntriesHook is called with each batch of log entries as it is sent. It is
+// called from the goroutine sending the batch, so it must be fast and must not
+// retain or modify the batch or its entries.
+type EntriesHook func(list *pb.LogEntry_List)
+
+// validateEndpoint returns an error if the endpoint can't possibly be dialed,
+// so that remote logging fails fast rather than retrying forever.
+func validateEndpoint(endpoint string) error {
+	switch {
+	case strings.TrimSpace(endpoint) == "":
+		return fmt.Errorf("no logging endpoint")
+	case strings.ContainsAny(endpoint, " \t\n"):
+		return fmt.Errorf("invalid logging endpoint %q", endpoint)
+	case strings.HasPrefix(endpoint, unixScheme):
+		if path, _ := unixSocketPath(endpoint); path == "" {
+			return fmt.Errorf("invalid logging endpoint %q: no socket path", endpoint)
+		}
+		return nil
+	case strings.Contains(endpoint, "://"):
+		return nil // a target URI of a gRPC resolver
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return fmt.Errorf("invalid logging endpoint %q: %v", endpoint, err)
+	}
+	return nil
+}
+
+// unixScheme is the prefix of endpoints that are Unix domain sockets, such as
+// unix:///run/beam/logging.sock, rather than network addresses.
+const unixScheme = "unix://"
+
+// unixSocketPath returns the path of the Unix domain socket of the endpoint,
+// and whether it is one.
+func unixSocketPath(endpoint string) (string, bool) {
+	if !strings.HasPrefix(endpoint, unixScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(endpoint, unixScheme), true
+}
+
+// Remote is a handle to the remote logging set up by Start.
+type Remote struct {
+	*logger
+
+	prev   log.Logger
+	cancel context.CancelFunc
+	done   chan struct{}
+	// tees are the handles of the writers to additional sinks.
+	tees []*Remote
+	// disabled is set if logging is turned off, in which case there is no
+	// writer. See disabledLogging.
+	disabled bool
+	// closed is set once the writers are stopped, by Close or because the
+	// handle was replaced. It is accessed atomically.
+	closed int32
+}
+
+// replaceTimeout bounds how long setting up remote logging waits for the
+// writers of the remote logging set up before to stop.
+const replaceTimeout = 5 * time.Second
+
+var (
+	// activeMu serializes setting up remote logging, which replaces the
+	// active handle, and closing it.
+	activeMu sync.Mutex
+	// active is the handle installed by Start, until it is closed or replaced.
+	// Guarded by activeMu.
+	active *Remote
+)
+
+// replace stops the writers of the handle, once remote logging is set up
+// again in its place, such as by consecutive tests, so that they don't outlive
+// it. The entries that are still logged with its logger are written to stderr.
+func (r *Remote) replace() {
+	atomic.StoreInt32(&r.draining, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), replaceTimeout)
+	defer cancel()
+	r.stop(ctx)
+}
+
+// Done returns a channel that is closed once the writer has stopped.
+func (r *Remote) Done() <-chan struct{} {
+	return r.done
+}
+
+// Close stops remote logging and restores the logger installed before it was
+// set up. The buffered entries are flushed first, bounded by ctx. Close then
+// stops the writer and waits for it to finish. Once the handle is replaced by
+// setting up remote logging again, Close leaves the logger as is.
+func (r *Remote) Close(ctx context.Context) error {
+	activeMu.Lock()
+	// A replaced handle no longer owns the installed logger.
+	if active == r {
+		active = nil
+		log.SetLogger(r.prev)
+	}
+	activeMu.Unlock()
+	if r.disabled {
+		return nil
+	}
+	return r.stop(ctx)
+}
+
+// stop flushes the buffered entries, bounded by ctx, and stops the writers,
+// waiting for them to finish. Only the first call has an effect.
+func (r *Remote) stop(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return nil
+	}
+	err := r.Flush(ctx)
+	r.cancel()
+	for _, t := range r.tees {
+		t.cancel()
+	}
+
+	for _, done := range r.writers() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+		}
+	}
+	return err
+}
+
+// Drain stops remote logging, such as when the worker is being shut down. The
+// handle stops accepting entries, which are written to stderr instead, and
+// the buffered entries are flushed, bounded by ctx. Entries that can't be
+// sent in time are written to stderr as well. Like Close, Drain restores the
+// previous logger. Only the first call has an effect.
+func (r *Remote) Drain(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&r.draining, 0, 1) {
+		return nil
+	}
+	err := r.Close(ctx)
+	if err != nil {
+		// The writers may still be sending their last batch, which they
+		// write to stderr if that fails, but whatever is still buffered
+		// won't be sent.
+		r.spill()
+		for _, t := range r.tees {
+			t.spill()
+		}
+	}
+	return err
+}
+
+// DrainOnSignal drains the remote logging once one of the signals, such as
+// SIGTERM, is received, bounded by signalDrainTimeout, and then raises the
+// signal again, with its default behavior restored. The returned function
+// stops listening for the signals.
+func (r *Remote) DrainOnSignal(sigs ...os.Signal) func() {
+	c := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		select {
+		case sig := <-c:
+			ctx, cancel := context.WithTimeout(context.Background(), signalDrainTimeout)
+			r.Drain(ctx)
+			cancel()
+
+			signal.Stop(c)
+			if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+				return
+			}
+			os.Exit(1)
+		case <-stop:
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(stop)
+	}
+}
+
+// writers returns the done channels of all writers of the handle.
+func (r *Remote) writers() []<-chan struct{} {
+	ret := []<-chan struct{}{r.done}
+	for _, t := range r.tees {
+		ret = append(ret, t.done)
+	}
+	return ret
+}
+
+// Start redirects local log messages to FnHarness. It will try to reconnect, if
+// a connection goes bad. Falls back to stdout. If the endpoint is empty or
+// invalid, and no sink is set, messages are written to stderr instead. The
+// returned handle stops remote logging when closed. If logging is disabled,
+// nothing is logged at all. Remote logging that is still set up is stopped
+// first, so that it may be set up repeatedly, such as by tests; calls are
+// serialized.
+func Start(ctx context.Context, endpoint string, opts Options) *Remote {
+	opts = opts.withDefaults()
+
+	// The labels are read once, since they don't change while the worker
+	// runs. They are read before taking activeMu, since the provisioning
+	// service may take a while to answer.
+	var provisionErr error
+	if opts.ProvisionEndpoint != "" && !opts.disabled {
+		opts.labelFields, provisionErr = provisionFields(ctx, opts.ProvisionEndpoint, opts.ProvisionLabels)
+	}
+
+	// Remote logging set up before, and not closed, is replaced, restoring
+	// the logger installed before it once closed.
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	prev := log.GetLogger()
+	if active != nil {
+		prev = active.prev
+		active.replace()
+		active = nil
+	}
+	if opts.disabled {
+		active = disabledLogging(prev)
+		return active
+	}
+	var disabled error
+	if opts.Sink == nil {
+		if err := validateEndpoint(endpoint); err != nil {
+			opts.Sink = stderrSink{format: opts.fallbackFormat, color: fallbackColor(opts.FallbackWriter), out: opts.FallbackWriter}
+			disabled = err
+		}
+	}
+
+	var fileErr error
+	if opts.fileDir != "" {
+		if sink, err := NewFileSink(opts.fileDir, int64(opts.fileMaxBytes), opts.fileMaxFiles); err != nil {
+			fileErr = err
+		} else {
+			opts.Sinks = append(opts.Sinks[:len(opts.Sinks):len(opts.Sinks)], sink)
+		}
+	}
+
+	r := startLogging(ctx, endpoint, opts.Sink, opts)
+	r.prev = prev
+	go r.logger.sampleBufferDepth(r.done)
+
+	// Each additional sink has its own buffer and writer, so that a slow or
+	// failing sink doesn't hold up the others. Only the main logger keeps a
+	// recorder, since the tees are only buffered to.
+	topts := opts
+	topts.recorderSize = -1
+	for _, sink := range opts.Sinks {
+		t := startLogging(ctx, "", sink, topts)
+		r.logger.tees = append(r.logger.tees, t.logger)
+		r.tees = append(r.tees, t)
+	}
+	var routeErrs []error
+	for _, route := range opts.Routes {
+		t, err := startRoute(ctx, route, topts)
+		if err != nil {
+			routeErrs = append(routeErrs, err)
+			continue
+		}
+		r.logger.tees = append(r.logger.tees, t.logger)
+		r.tees = append(r.tees, t)
+	}
+	log.SetLogger(r.logger)
+	active = r
+
+	if disabled != nil {
+		log.Infof(ctx, "Remote logging disabled: %v. Logging to stderr.", disabled)
+	}
+	if fileErr != nil {
+		log.Warnf(ctx, "Not logging to files in %v: %v", opts.fileDir, fileErr)
+	}
+	if provisionErr != nil {
+		log.Warnf(ctx, "Not attaching provisioning labels: %v", provisionErr)
+	}
+	for _, err := range routeErrs {
+		log.Warnf(ctx, "Log route disabled: %v", err)
+	}
+	return r
+}
+
+// streamMetadataPrefix prefixes the keys of the fields sent as the metadata of
+// the FnLogging stream.
+const streamMetadataPrefix = "beam-log-"
+
+// streamMetadata returns the fields as the metadata of the FnLogging stream,
+// with prefixed keys. gRPC metadata values must be printable ASCII, so other
+// values are quoted, with escapes.
+func streamMetadata(fields log.Fields) map[string]string {
+	md := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if !isPrintableASCII(v) {
+			v = strconv.QuoteToASCII(v)
+		}
+		md[streamMetadataPrefix+k] = v
+	}
+	return md
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// workerFields returns the fields identifying the worker, its ID and hostname,
+// if ctx carries the worker ID, as it does when the harness is started by the
+// container. Otherwise, it returns nil.
+func workerFields(ctx context.Context) log.Fields {
+	id, err := grpcx.ReadOutgoingWorkerID(ctx)
+	if err != nil {
+		return nil
+	}
+	fields := log.Fields{"worker_id": id}
+	if host, err := os.Hostname(); err == nil {
+		fields["hostname"] = host
+	}
+	return fields
+}
+
+// startLogging starts a writer to the sink, or to the endpoint if the sink is
+// nil, and returns a handle to it along with its logger. The logger is not
+// installed.
+func startLogging(ctx context.Context, endpoint string, sink Sink, opts Options) *Remote {
+	buf := make(chan *pb.LogEntry, opts.bufferSize)
+	priority := make(chan *pb.LogEntry, priorityBufferSize)
+	flushes := make(chan chan error)
+	freed := make(chan struct{}, 1)
+	stats := &logStats{}
+	l := &logger{
+		out:            buf,
+		priority:       priority,
+		flushes:        flushes,
+		freed:          freed,
+		stats:          stats,
+		omitLocation:   opts.omitLocation,
+		fullLocation:   opts.fullLocation,
+		maxBytes:       int64(opts.bufferBytes),
+		maxMessageSize: opts.maxMessageSize,
+		traceLevel:     opts.traceLevel,
+		maxTraceSize:   opts.maxTraceSize,
+		dropPolicy:     opts.dropPolicy,
+		blockTimeout:   opts.blockTimeout,
+		fallbackFormat: opts.fallbackFormat,
+		color:          fallbackColor(opts.FallbackWriter),
+		stderr:         opts.FallbackWriter,
+		synchronous:    opts.synchronous,
+		fatalFlush:     opts.fatalFlushTimeout,
+		eventTime:      opts.eventTime,
+		redact:         opts.Redact,
+		spanContext:    opts.SpanContext,
+		severities:     opts.Severities,
+	}
+	// The fields identifying the worker, and the labels, are the same for
+	// all entries, so they are computed once. They are appended to every
+	// message, unless omitted, and sent once per stream, as its metadata.
+	streamFields := withLabels(workerFields(ctx), opts.labelFields)
+	if !opts.omitMessageFields {
+		l.suffix = appendFields("", streamFields)
+	}
+	if len(streamFields) > 0 {
+		ctx = grpcx.WriteMetadata(ctx, streamMetadata(streamFields))
+	}
+	l.setLevel(opts.Level)
+	if opts.blockThreshold > 0 && opts.blockThreshold <= 1 {
+		l.blockThreshold = int(opts.blockThreshold * float64(opts.bufferSize))
+		if l.blockThreshold == 0 {
+			l.blockThreshold = 1
+		}
+	}
+	if len(opts.PackageLevels) > 0 {
+		l.packages = newPackageLevels(opts.PackageLevels)
+	}
+	if opts.recorderSize > 0 {
+		l.recorder = newRingSink(opts.recorderSize)
+		l.recordLevel = opts.recorderLevel
+	}
+	if opts.dedupWindow > 0 {
+		l.dedup = newDeduper(opts.dedupWindow)
+	}
+	if opts.siteRate > 0 {
+		l.sampler = newSiteSampler(opts.siteRate)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Remote{
+		logger: l,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	w := &remoteWriter{
+		buffer:        buf,
+		priority:      priority,
+		flushes:       flushes,
+		freed:         freed,
+		stats:         stats,
+		endpoint:      endpoint,
+		sink:          sink,
+		dialOptions:   opts.DialOptions,
+		batchSize:     opts.batchSize,
+		maxBatchBytes: opts.maxBatchBytes,
+		flushInterval: opts.flushInterval,
+		dialTimeout:   opts.dialTimeout,
+		maxRetries:    opts.maxRetries,
+		sendTimeout:   opts.sendTimeout,
+		compress:      opts.compress,
+		keepalive:     opts.keepalive,
+		backoffBase:   defaultBackoffBase,
+		backoffMax:    defaultBackoffMax,
+		hooks:         opts.Hooks,
+		diagnostics:   opts.Diagnostics,
+		atLeastOnce:   opts.delivery == deliveryAtLeastOnce,
+
+		fallbackFormat: l.fallbackFormat,
+		healthInterval: opts.healthInterval,
+		color:          l.color,
+		stderr:         l.stderr,
+		severities:     l.severities,
+	}
+	if l.dedup != nil {
+		w.sweep = l.sweepRepeats
+	}
+	l.config = w.writerConfig()
+	go func() {
+		defer close(r.done)
+		w.Run(context.WithValue(ctx, writerKey, true))
+		w.closeSink(sink)
+	}()
+	return r
+}
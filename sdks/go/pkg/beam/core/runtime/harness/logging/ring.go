@@ -0,0 +1,116 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+const (
+	// defaultRecorderSize is the number of recent entries that aren't sent
+	// kept in memory for crash diagnostics. The recorder is off by default.
+	defaultRecorderSize = 0
+	// defaultRecorderLevel is the minimum severity of the entries kept once
+	// the recorder is on. Entries below it aren't formatted unless they are
+	// logged.
+	defaultRecorderLevel = log.SevDebug
+)
+
+// ringSink is a Sink that keeps the most recent entries in memory, in a
+// ring buffer of fixed size, so that they can be dumped as context when the
+// worker crashes. Once the buffer is full, each entry replaces the oldest.
+type ringSink struct {
+	mu      sync.Mutex
+	entries []*pb.LogEntry
+	// next is the index of the slot of the next entry, which holds the
+	// oldest entry once the buffer is full.
+	next int
+	full bool
+}
+
+func newRingSink(size int) *ringSink {
+	return &ringSink{entries: make([]*pb.LogEntry, size)}
+}
+
+// Send keeps a copy of each entry of the list.
+func (s *ringSink) Send(list *pb.LogEntry_List) error {
+	for _, entry := range list.GetLogEntries() {
+		s.add(copyEntry(entry))
+	}
+	return nil
+}
+
+// add keeps the entry, which the sink then owns.
+func (s *ringSink) add(entry *pb.LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old := s.entries[s.next]; old != nil {
+		releaseEntry(old)
+	}
+	s.entries[s.next] = entry
+	s.next++
+	if s.next == len(s.entries) {
+		s.next, s.full = 0, true
+	}
+}
+
+// take returns the kept entries, from the oldest to the most recent, which
+// the caller then owns, and empties the sink.
+func (s *ringSink) take() []*pb.LogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ret []*pb.LogEntry
+	if s.full {
+		ret = append(ret, s.entries[s.next:]...)
+	}
+	ret = append(ret, s.entries[:s.next]...)
+	for i := range s.entries {
+		s.entries[i] = nil
+	}
+	s.next, s.full = 0, false
+	return ret
+}
+
+// records returns whether entries of the given severity are kept by the
+// recorder, if any.
+func (l *logger) records(sev log.Severity) bool {
+	return l.recorder != nil && sev.AtLeast(l.recordLevel)
+}
+
+// record keeps an entry for a message that isn't logged in the recorder. The
+// entry has no location, since looking it up for every filtered message would
+// be too expensive.
+func (l *logger) record(ctx context.Context, b *binding, sev log.Severity, msg string) {
+	entry := newEntry(l.stamp(ctx, l.timeNow()), l.severity(sev), l.message(ctx, b, msg))
+	b.setReferences(ctx, entry)
+	l.recorder.add(entry)
+}
+
+// sendRecorded enqueues the entries kept by the recorder, at their own
+// severities, ahead of a fatal entry, as context for the crash. They are
+// enqueued in the priority buffer, like the fatal entry, so that they are
+// sent before it, and aren't sent again by a later fatal entry.
+func (l *logger) sendRecorded() {
+	for _, entry := range l.recorder.take() {
+		l.buffer(log.SevFatal, entry, false)
+	}
+}
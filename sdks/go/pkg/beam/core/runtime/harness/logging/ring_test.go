@@ -0,0 +1,107 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestRingSink(t *testing.T) {
+	s := newRingSink(3)
+	if got := s.take(); len(got) != 0 {
+		t.Fatalf("take() of an empty sink = %v, want none", got)
+	}
+
+	var list pb.LogEntry_List
+	for i := 0; i < 5; i++ {
+		list.LogEntries = append(list.LogEntries, newEntry(time.Now(), pb.LogEntry_Severity_INFO, strconv.Itoa(i)))
+	}
+	if err := s.Send(&list); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	var got []string
+	for _, entry := range s.take() {
+		got = append(got, entry.GetMessage())
+	}
+	if want := []string{"2", "3", "4"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("take() = %v, want %v", got, want)
+	}
+	if got := s.take(); len(got) != 0 {
+		t.Errorf("take() after take() = %v, want none", got)
+	}
+}
+
+func TestLogRecorder(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 10)
+	l := &logger{out: buf, priority: make(chan *pb.LogEntry, 10), stats: &logStats{}, omitLocation: true}
+	l.setLevel(log.SevInfo)
+	l.recorder = newRingSink(10)
+	l.recordLevel = log.SevDebug
+
+	ctx := context.Background()
+	if !l.Enabled(ctx, log.SevDebug) || l.Enabled(ctx, log.SevTrace) {
+		t.Errorf("Enabled() doesn't account for the recorder level")
+	}
+	l.Log(ctx, log.SevTrace, 1, "trace")
+	l.Log(ctx, log.SevDebug, 1, "debug")
+	l.Log(ctx, log.SevInfo, 1, "info")
+	if len(buf) != 1 {
+		t.Fatalf("%v entries logged, want 1", len(buf))
+	}
+	<-buf
+
+	// The fatal entry is flushed, which is acknowledged without sending. It
+	// is preceded by the entry that was only recorded, at its own severity.
+	flushes := make(chan chan error, 1)
+	l.flushes = flushes
+	go func() { (<-flushes) <- nil }()
+	l.write(context.Background(), log.SevFatal, newEntry(time.Now(), pb.LogEntry_Severity_CRITICAL, "fatal"))
+
+	if len(l.priority) != 2 {
+		t.Fatalf("%v priority entries, want the recorded entry and the fatal one", len(l.priority))
+	}
+	if e := <-l.priority; e.GetMessage() != "debug" || e.GetSeverity() != pb.LogEntry_Severity_DEBUG {
+		t.Errorf("first entry = %v, want the recorded debug entry", e)
+	}
+	if got := (<-l.priority).GetMessage(); got != "fatal" {
+		t.Errorf("second entry = %q, want the fatal one", got)
+	}
+	if got := l.recorder.take(); len(got) != 0 {
+		t.Errorf("recorder kept %v after the fatal entry, want none", got)
+	}
+}
+
+func TestLogRecorderDefaults(t *testing.T) {
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: &collectSink{}, Level: log.SevInfo})
+	defer r.Close(ctx)
+
+	// The recorder is off by default, so Debug messages can be skipped.
+	if log.Enabled(ctx, log.SevDebug) {
+		t.Errorf("Enabled(SevDebug) = true, want false")
+	}
+	if l := log.GetLogger().(*logger); l.recorder != nil {
+		t.Errorf("recorder set up by default")
+	}
+}
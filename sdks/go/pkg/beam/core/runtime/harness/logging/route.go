@@ -0,0 +1,60 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// routeBufferSize is the capacity of the buffer of each route, which only
+// receives the few severe entries.
+const routeBufferSize = 100
+
+// Route mirrors the log entries at or above a severity to a secondary
+// destination, such as an incident sink for alerting, in addition to the
+// FnLogging service of the runner.
+type Route struct {
+	// Level is the minimum severity of the entries that are routed, such as
+	// log.SevError.
+	Level log.Severity
+	// Endpoint is the FnLogging service the entries are sent to, unless
+	// Sink is set.
+	Endpoint string
+	// Sink, if set, receives the entries instead of Endpoint.
+	Sink Sink
+}
+
+// startRoute starts a writer for the route, like that of an additional sink,
+// which only receives the entries at or above the severity of the route.
+func startRoute(ctx context.Context, route Route, opts Options) (*Remote, error) {
+	if route.Sink == nil {
+		if err := validateEndpoint(route.Endpoint); err != nil {
+			return nil, err
+		}
+	}
+	if route.Level <= log.SevUnspecified {
+		return nil, fmt.Errorf("no severity for the route to %v", route.Endpoint)
+	}
+	opts.bufferSize = routeBufferSize
+	opts.blockThreshold = 0
+	opts.recorderSize = -1
+	r := startLogging(ctx, route.Endpoint, route.Sink, opts)
+	r.logger.routeLevel = route.Level
+	return r, nil
+}
@@ -0,0 +1,109 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+func TestRoute(t *testing.T) {
+	sink, route := &collectSink{}, &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{
+		Sink:   sink,
+		Routes: []Route{{Level: log.SevError, Sink: route}},
+	})
+	log.Info(ctx, "info")
+	log.Warn(ctx, "warn")
+	log.Error(ctx, "error")
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got := len(sink.entries); got != 3 {
+		t.Errorf("sink received %v entries, want 3", got)
+	}
+	if len(route.entries) != 1 || route.entries[0].GetMessage() != "error" {
+		t.Errorf("route received %v, want a single entry %q", route.entries, "error")
+	}
+}
+
+func TestRouteInvalid(t *testing.T) {
+	sink := &collectSink{}
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{
+		Sink:   sink,
+		Routes: []Route{{Level: log.SevError}, {Sink: &collectSink{}}},
+	})
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	var warnings int
+	for _, entry := range sink.entries {
+		if strings.HasPrefix(entry.GetMessage(), "Log route disabled") {
+			warnings++
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("sink received %v, want a warning for each invalid route", sink.entries)
+	}
+	if len(r.tees) != 0 {
+		t.Errorf("started %v routes, want none", len(r.tees))
+	}
+}
+
+func TestRouteNonBlocking(t *testing.T) {
+	sink, route := &collectSink{}, &blockingSink{unblock: make(chan struct{})}
+	defer close(route.unblock)
+
+	ctx := context.Background()
+	r := Start(ctx, "", Options{
+		Sink:           sink,
+		Routes:         []Route{{Level: log.SevError, Sink: route}},
+		FallbackWriter: &syncBuffer{},
+		synchronous:    true,
+	})
+
+	// The stalled route fills up, and drops the rest, without holding up
+	// the synchronous sends to the sink.
+	start := time.Now()
+	for i := 0; i < 2*routeBufferSize+10; i++ {
+		log.Error(ctx, "error")
+	}
+	if elapsed := time.Since(start); elapsed > syncFlushTimeout {
+		t.Errorf("logging took %v, want it not to wait for the route", elapsed)
+	}
+	sink.mu.Lock()
+	if got, want := len(sink.entries), 2*routeBufferSize+10; got != want {
+		t.Errorf("sink received %v entries, want %v", got, want)
+	}
+	sink.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	r.Drain(ctx)
+	if r.tees[0].Dropped() == 0 {
+		t.Error("route dropped no entries, want the overflow dropped")
+	}
+}
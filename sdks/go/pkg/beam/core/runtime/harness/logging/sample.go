@@ -0,0 +1,71 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// maxSampledSites bounds the number of call sites tracked by a siteSampler.
+// Once reached, the tracked sites are forgotten.
+const maxSampledSites = 10000
+
+type site struct {
+	file string
+	line int
+}
+
+type siteCount struct {
+	second int64 // the Unix second the count is for
+	n      int
+}
+
+// siteSampler limits the number of messages logged from each call site to a
+// rate per second. Messages beyond the rate are dropped.
+type siteSampler struct {
+	rate int
+
+	mu    sync.Mutex
+	sites map[site]*siteCount
+}
+
+func newSiteSampler(rate int) *siteSampler {
+	return &siteSampler{rate: rate, sites: make(map[site]*siteCount)}
+}
+
+// allow returns whether a message logged at the given time from the call site
+// is within the rate.
+func (s *siteSampler) allow(now time.Time, file string, line int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := site{file, line}
+	sec := now.Unix()
+	c, ok := s.sites[k]
+	if !ok {
+		if len(s.sites) >= maxSampledSites {
+			s.sites = make(map[site]*siteCount)
+		}
+		c = &siteCount{}
+		s.sites[k] = c
+	}
+	if c.second != sec {
+		c.second, c.n = sec, 0
+	}
+	c.n++
+	return c.n <= s.rate
+}
@@ -0,0 +1,57 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogSiteRate(t *testing.T) {
+	now := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	line := 1
+	buf := make(chan *pb.LogEntry, 10)
+	l := &logger{
+		out:     buf,
+		stats:   &logStats{},
+		now:     func() time.Time { return now },
+		sampler: newSiteSampler(2),
+		caller: func(int) (uintptr, string, int, bool) {
+			return 0, "file.go", line, true
+		},
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		l.Log(ctx, log.SevInfo, 0, "hot")
+	}
+	line = 2 // another call site isn't limited by the first
+	l.Log(ctx, log.SevInfo, 0, "cold")
+	line = 1
+	now = now.Add(time.Second) // the next second has its own allowance
+	l.Log(ctx, log.SevInfo, 0, "hot")
+
+	if got, want := len(buf), 4; got != want {
+		t.Errorf("logged %v entries, want %v", got, want)
+	}
+	if got, want := l.Sampled(), int64(2); got != want {
+		t.Errorf("Sampled() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/util/grpcx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeLoggingServer is an in-memory FnLogging service that records the
+// LogEntry_Lists it receives.
+type fakeLoggingServer struct {
+	mu    sync.Mutex
+	lists []*pb.LogEntry_List
+	// received is signalled, without blocking, whenever a list is received.
+	received chan struct{}
+	// srv and lis are the server and the listener it is serving on. They
+	// are replaced once an outage ends. Guarded by mu.
+	srv *grpc.Server
+	lis *bufconn.Listener
+	// controls are sent at the start of each stream. Guarded by mu.
+	controls []*pb.LogControl
+	// metadata is the metadata of each stream, in order. Guarded by mu.
+	metadata []metadata.MD
+	// failStreams is the number of streams that fail after receiving their
+	// first list, leaving the connection up. Guarded by mu.
+	failStreams int
+	// loseStreams is the number of streams that fail after receiving their
+	// first list, without keeping it, as if it was lost in transit. Guarded
+	// by mu.
+	loseStreams int
+	// closeStreams is the number of streams that the server ends cleanly
+	// after receiving their first list, as when shutting down. Guarded by
+	// mu.
+	closeStreams int
+}
+
+func (f *fakeLoggingServer) Logging(stream pb.BeamFnLogging_LoggingServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	f.mu.Lock()
+	controls := f.controls
+	f.metadata = append(f.metadata, md)
+	f.mu.Unlock()
+	for _, c := range controls {
+		if err := stream.Send(c); err != nil {
+			return err
+		}
+	}
+	for {
+		list, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		f.mu.Lock()
+		if f.loseStreams > 0 {
+			f.loseStreams--
+			f.mu.Unlock()
+			return status.Error(codes.Unavailable, "stream lost")
+		}
+		f.lists = append(f.lists, list)
+		fail := f.failStreams > 0
+		if fail {
+			f.failStreams--
+		}
+		end := !fail && f.closeStreams > 0
+		if end {
+			f.closeStreams--
+		}
+		f.mu.Unlock()
+
+		select {
+		case f.received <- struct{}{}:
+		default:
+		}
+		if fail {
+			return status.Error(codes.Unavailable, "stream failed")
+		}
+		if end {
+			return nil
+		}
+	}
+}
+
+// Dialer returns a dial option that connects to the server.
+func (f *fakeLoggingServer) Dialer() grpc.DialOption {
+	return grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		f.mu.Lock()
+		lis := f.lis
+		f.mu.Unlock()
+		return lis.Dial()
+	})
+}
+
+// serve starts serving on a new listener.
+func (f *fakeLoggingServer) serve() {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterBeamFnLoggingServer(srv, f)
+	go srv.Serve(lis)
+
+	f.mu.Lock()
+	f.srv, f.lis = srv, lis
+	f.mu.Unlock()
+}
+
+// stop stops the server, dropping its connections.
+func (f *fakeLoggingServer) stop() {
+	f.mu.Lock()
+	srv := f.srv
+	f.mu.Unlock()
+	srv.Stop()
+}
+
+// Outage stops the server, dropping its connections, as in a transient
+// failure of the runner. Dialing fails until the returned function is called,
+// which serves again.
+func (f *fakeLoggingServer) Outage() func() {
+	f.stop()
+	return f.serve
+}
+
+// Metadata returns the metadata of the streams so far.
+func (f *fakeLoggingServer) Metadata() []metadata.MD {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]metadata.MD(nil), f.metadata...)
+}
+
+// Lists returns the LogEntry_Lists received so far.
+func (f *fakeLoggingServer) Lists() []*pb.LogEntry_List {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*pb.LogEntry_List(nil), f.lists...)
+}
+
+// Entries returns the entries received so far, in order, whose message has
+// the given prefix.
+func (f *fakeLoggingServer) Entries(prefix string) []*pb.LogEntry {
+	var ret []*pb.LogEntry
+	for _, list := range f.Lists() {
+		for _, e := range list.GetLogEntries() {
+			if strings.HasPrefix(e.GetMessage(), prefix) {
+				ret = append(ret, e)
+			}
+		}
+	}
+	return ret
+}
+
+// WaitForEntries waits until at least n entries with the given message prefix
+// have been received, failing the test if that takes too long.
+func (f *fakeLoggingServer) WaitForEntries(t *testing.T, prefix string, n int) []*pb.LogEntry {
+	t.Helper()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		if entries := f.Entries(prefix); len(entries) >= n {
+			return entries
+		}
+		select {
+		case <-f.received:
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatalf("received %v entries with prefix %q, want at least %v", len(f.Entries(prefix)), prefix, n)
+		}
+	}
+}
+
+// startFakeLoggingServer starts a fakeLoggingServer on an in-memory bufconn
+// listener. It returns the server, the endpoint to dial it with, and a
+// function that stops the server. While running, grpcx.Dial and
+// grpcx.DialWithOptions are redirected to the listener for that endpoint.
+func startFakeLoggingServer(t *testing.T) (*fakeLoggingServer, string, func()) {
+	t.Helper()
+
+	f := &fakeLoggingServer{received: make(chan struct{}, 1)}
+	f.serve()
+
+	endpoint := "bufconn:" + t.Name()
+	prev, prevWithOptions := grpcx.Dial, grpcx.DialWithOptions
+	grpcx.DialWithOptions = func(ctx context.Context, e string, timeout time.Duration, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+		if e != endpoint {
+			return prevWithOptions(ctx, e, timeout, opts...)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		opts = append([]grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock(), f.Dialer()}, opts...)
+		return grpc.DialContext(ctx, e, opts...)
+	}
+	grpcx.Dial = func(ctx context.Context, e string, timeout time.Duration) (*grpc.ClientConn, error) {
+		if e != endpoint {
+			return prev(ctx, e, timeout)
+		}
+		return grpcx.DialWithOptions(ctx, e, timeout)
+	}
+
+	stop := func() {
+		grpcx.Dial, grpcx.DialWithOptions = prev, prevWithOptions
+		f.stop()
+	}
+	return f, endpoint, stop
+}
@@ -0,0 +1,133 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+// SeverityMapping maps the severity of a message to that of its LogEntry,
+// such as to send warnings as errors:
+//
+//	opts.Severities = func(sev log.Severity) pb.LogEntry_Severity_Enum {
+//		if sev == log.SevWarn {
+//			return pb.LogEntry_Severity_ERROR
+//		}
+//		return logging.DefaultSeverityMapping(sev)
+//	}
+type SeverityMapping func(sev log.Severity) pb.LogEntry_Severity_Enum
+
+// DefaultSeverityMapping is the default mapping of the severities of messages
+// to those of entries. Fatal messages are CRITICAL.
+func DefaultSeverityMapping(sev log.Severity) pb.LogEntry_Severity_Enum {
+	return convertSeverity(sev)
+}
+
+// severity returns the severity of the entry of a message with the given
+// severity.
+func (l *logger) severity(sev log.Severity) pb.LogEntry_Severity_Enum {
+	if l.severities == nil {
+		return convertSeverity(sev)
+	}
+	return l.severities(sev)
+}
+
+// severity returns the severity of an entry of the writer with the given
+// severity.
+func (w *remoteWriter) severity(sev log.Severity) pb.LogEntry_Severity_Enum {
+	if w.severities == nil {
+		return convertSeverity(sev)
+	}
+	return w.severities(sev)
+}
+
+// defaultLogLevel is the minimum severity of entries sent to the runner,
+// unless configured otherwise.
+const defaultLogLevel = log.SevInfo
+
+// ParseLevel returns the severity named by the worker_log_level pipeline
+// option. An empty value yields defaultLogLevel. An invalid value yields
+// defaultLogLevel along with an error describing the bad value.
+func ParseLevel(level string) (log.Severity, error) {
+	switch strings.ToLower(level) {
+	case "":
+		return defaultLogLevel, nil
+	case "trace":
+		return log.SevTrace, nil
+	case "debug":
+		return log.SevDebug, nil
+	case "info":
+		return log.SevInfo, nil
+	case "notice":
+		return log.SevNotice, nil
+	case "warn", "warning":
+		return log.SevWarn, nil
+	case "error":
+		return log.SevError, nil
+	case "fatal", "critical":
+		return log.SevFatal, nil
+	default:
+		return defaultLogLevel, fmt.Errorf("invalid worker_log_level %q, using INFO", level)
+	}
+}
+
+func convertSeverity(sev log.Severity) pb.LogEntry_Severity_Enum {
+	switch sev {
+	case log.SevTrace:
+		return pb.LogEntry_Severity_TRACE
+	case log.SevDebug:
+		return pb.LogEntry_Severity_DEBUG
+	case log.SevInfo:
+		return pb.LogEntry_Severity_INFO
+	case log.SevNotice:
+		return pb.LogEntry_Severity_NOTICE
+	case log.SevWarn:
+		return pb.LogEntry_Severity_WARN
+	case log.SevError:
+		return pb.LogEntry_Severity_ERROR
+	case log.SevFatal:
+		return pb.LogEntry_Severity_CRITICAL
+	default:
+		return pb.LogEntry_Severity_INFO
+	}
+}
+
+// fromProtoSeverity is the inverse of convertSeverity. Unknown values map to
+// SevUnspecified.
+func fromProtoSeverity(sev pb.LogEntry_Severity_Enum) log.Severity {
+	switch sev {
+	case pb.LogEntry_Severity_TRACE:
+		return log.SevTrace
+	case pb.LogEntry_Severity_DEBUG:
+		return log.SevDebug
+	case pb.LogEntry_Severity_INFO:
+		return log.SevInfo
+	case pb.LogEntry_Severity_NOTICE:
+		return log.SevNotice
+	case pb.LogEntry_Severity_WARN:
+		return log.SevWarn
+	case pb.LogEntry_Severity_ERROR:
+		return log.SevError
+	case pb.LogEntry_Severity_CRITICAL:
+		return log.SevFatal
+	default:
+		return log.SevUnspecified
+	}
+}
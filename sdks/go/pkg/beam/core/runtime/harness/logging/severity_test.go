@@ -0,0 +1,47 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestLogSeverityMapping(t *testing.T) {
+	warnAsError := func(sev log.Severity) pb.LogEntry_Severity_Enum {
+		if sev == log.SevWarn {
+			return pb.LogEntry_Severity_ERROR
+		}
+		return DefaultSeverityMapping(sev)
+	}
+	buf := make(chan *pb.LogEntry, 10)
+	priority := make(chan *pb.LogEntry, 10)
+	l := &logger{out: buf, priority: priority, stats: &logStats{}, severities: warnAsError}
+
+	ctx := context.Background()
+	l.Log(ctx, log.SevInfo, 1, "info")
+	l.Log(ctx, log.SevWarn, 1, "warn")
+	if got := (<-buf).GetSeverity(); got != pb.LogEntry_Severity_INFO {
+		t.Errorf("info severity = %v, want INFO", got)
+	}
+	// The entry is still buffered as a warning.
+	if got := (<-priority).GetSeverity(); got != pb.LogEntry_Severity_ERROR {
+		t.Errorf("warn severity = %v, want ERROR", got)
+	}
+}
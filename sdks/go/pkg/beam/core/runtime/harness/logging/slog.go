@@ -0,0 +1,146 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// NewSlogHandler returns a slog.Handler that writes records to the global
+// logger, so that user code logging with log/slog has its logs sent to the
+// runner once remote logging is set up. Attributes are added as log fields,
+// with the names of enclosing groups as dot-separated prefixes.
+func NewSlogHandler() slog.Handler {
+	return &slogHandler{}
+}
+
+type slogHandler struct {
+	fields log.Fields
+	prefix string // enclosing groups, each followed by a dot
+}
+
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if l, ok := log.GetLogger().(*logger); ok {
+		return l.Enabled(ctx, fromSlogLevel(level))
+	}
+	return true
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make(log.Fields, len(h.fields)+r.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.prefix, a)
+		return true
+	})
+	if len(fields) > 0 {
+		ctx = log.WithFields(ctx, fields)
+	}
+
+	sev := fromSlogLevel(r.Level)
+	l, ok := log.GetLogger().(*logger)
+	if !ok {
+		log.Output(ctx, sev, 1, r.Message)
+		return nil
+	}
+	if !l.enabled(sev) || (r.PC != 0 && !l.enabledAt(r.PC, sev)) {
+		if l.records(sev) {
+			l.record(ctx, nil, sev, r.Message)
+		}
+		return nil
+	}
+
+	// The location is that of the slog call, rather than of this handler.
+	var file string
+	var line int
+	if r.PC != 0 && !l.omitLocation {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		file, line = frame.File, frame.Line
+	}
+	// A record without a time, such as one built by hand, is entered at the
+	// time it is handled, as slog.Handler requires.
+	t := r.Time
+	if t.IsZero() {
+		t = l.timeNow()
+	}
+	l.output(ctx, nil, sev, t, file, line, r.Message)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(log.Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	for _, a := range attrs {
+		addAttr(fields, h.prefix, a)
+	}
+	return &slogHandler{fields: fields, prefix: h.prefix}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+// addAttr adds the attribute to the fields, flattening groups into prefixed
+// keys. Empty attributes are ignored, as slog handlers should.
+func addAttr(fields log.Fields, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(fields, prefix, ga)
+		}
+		return
+	}
+	fields[prefix+a.Key] = a.Value.String()
+}
+
+// fromSlogLevel converts a slog.Level to the nearest log.Severity at or below
+// it.
+func fromSlogLevel(level slog.Level) log.Severity {
+	switch {
+	case level >= slog.LevelError:
+		return log.SevError
+	case level >= slog.LevelWarn:
+		return log.SevWarn
+	case level >= slog.LevelInfo+2:
+		return log.SevNotice
+	case level >= slog.LevelInfo:
+		return log.SevInfo
+	case level >= slog.LevelDebug:
+		return log.SevDebug
+	default:
+		return log.SevTrace
+	}
+}
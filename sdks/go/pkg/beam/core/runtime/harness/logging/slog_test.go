@@ -0,0 +1,83 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/golang/protobuf/ptypes"
+)
+
+func TestSlogHandler(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	l := &logger{out: buf, stats: &logStats{}}
+	l.setLevel(log.SevInfo)
+
+	prev := log.GetLogger()
+	log.SetLogger(l)
+	defer log.SetLogger(prev)
+
+	sl := slog.New(NewSlogHandler()).With("job", "wordcount").WithGroup("dofn")
+	sl.Debug("filtered out")
+	sl.WarnContext(log.WithInstructionID(context.Background(), "inst1"), "slow element", "key", "a b")
+
+	if len(buf) != 1 {
+		t.Fatalf("buffered %v entries, want 1", len(buf))
+	}
+	entry := <-buf
+	if got, want := entry.GetMessage(), `slow element dofn.key="a b" job=wordcount`; got != want {
+		t.Errorf("Message = %q, want %q", got, want)
+	}
+	if got, want := entry.GetSeverity(), pb.LogEntry_Severity_WARN; got != want {
+		t.Errorf("Severity = %v, want %v", got, want)
+	}
+	if got, want := entry.GetInstructionReference(), "inst1"; got != want {
+		t.Errorf("InstructionReference = %q, want %q", got, want)
+	}
+	if got := entry.GetLogLocation(); !strings.HasPrefix(got, "logging/slog_test.go:") {
+		t.Errorf("LogLocation = %q, want logging/slog_test.go", got)
+	}
+}
+
+func TestSlogHandlerZeroTime(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 1)
+	now := time.Date(2018, time.October, 12, 10, 30, 0, 500, time.UTC)
+	l := &logger{out: buf, stats: &logStats{}, now: func() time.Time { return now }}
+	l.setLevel(log.SevInfo)
+
+	prev := log.GetLogger()
+	log.SetLogger(l)
+	defer log.SetLogger(prev)
+
+	// A record without a time is entered at the time it is handled.
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "no time", 0)
+	if err := NewSlogHandler().Handle(context.Background(), r); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	entry := <-buf
+	if got, _ := ptypes.Timestamp(entry.GetTimestamp()); !got.Equal(now) {
+		t.Errorf("Timestamp = %v, want %v", got, now)
+	}
+}
@@ -0,0 +1,57 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+// The fields identifying the trace span of a message.
+const (
+	traceIDField = "trace_id"
+	spanIDField  = "span_id"
+)
+
+// SpanContextFunc returns the IDs of the trace span in ctx, if any, and
+// whether there is one. It adapts a tracing library to the logging, which
+// doesn't depend on any. With OpenTelemetry, for example:
+//
+//	opts.SpanContext = func(ctx context.Context) (string, string, bool) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		return sc.TraceID().String(), sc.SpanID().String(), sc.IsValid()
+//	}
+type SpanContextFunc func(ctx context.Context) (traceID, spanID string, ok bool)
+
+// spanFields returns the fields with the IDs of the trace span of ctx added,
+// if there is one. The fields are copied rather than modified.
+func (l *logger) spanFields(ctx context.Context, fields log.Fields) log.Fields {
+	if l.spanContext == nil {
+		return fields
+	}
+	traceID, spanID, ok := l.spanContext(ctx)
+	if !ok {
+		return fields
+	}
+	withSpan := make(log.Fields, len(fields)+2)
+	for k, v := range fields {
+		withSpan[k] = v
+	}
+	withSpan[traceIDField] = traceID
+	withSpan[spanIDField] = spanID
+	return withSpan
+}
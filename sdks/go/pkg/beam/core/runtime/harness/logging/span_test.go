@@ -0,0 +1,51 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+type spanKey struct{}
+
+// testSpanContext finds the span IDs set in the context with spanKey.
+func testSpanContext(ctx context.Context) (string, string, bool) {
+	ids, ok := ctx.Value(spanKey{}).([2]string)
+	return ids[0], ids[1], ok
+}
+
+func TestLogSpanContext(t *testing.T) {
+	buf := make(chan *pb.LogEntry, 2)
+	l := &logger{out: buf, stats: &logStats{}, spanContext: testSpanContext}
+
+	fields := log.Fields{"user": "x"}
+	ctx := log.WithFields(context.Background(), fields)
+	l.Log(ctx, log.SevInfo, 1, "no span")
+	l.Log(context.WithValue(ctx, spanKey{}, [2]string{"t1", "s1"}), log.SevInfo, 1, "span")
+
+	for _, want := range []string{"no span user=x", "span span_id=s1 trace_id=t1 user=x"} {
+		if got := (<-buf).GetMessage(); got != want {
+			t.Errorf("message = %q, want %q", got, want)
+		}
+	}
+	if len(fields) != 1 {
+		t.Errorf("fields of the context were modified: %v", fields)
+	}
+}
@@ -0,0 +1,234 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// fallbackFormat is the format of log entries written to stderr.
+type fallbackFormat int
+
+const (
+	// fallbackPlain writes the severity and message of entries that can't
+	// be sent, and entries in the form of the standard Go logger if remote
+	// logging is disabled.
+	fallbackPlain fallbackFormat = iota
+	// fallbackJSON writes each entry as a single line JSON object, for log
+	// collectors scraping stderr.
+	fallbackJSON
+)
+
+// parseFallbackFormat returns the fallback format with the given name,
+// "plain" or "json".
+func parseFallbackFormat(name string) (fallbackFormat, error) {
+	switch strings.ToLower(name) {
+	case "plain":
+		return fallbackPlain, nil
+	case "json":
+		return fallbackJSON, nil
+	default:
+		return fallbackPlain, fmt.Errorf("invalid fallback format %q", name)
+	}
+}
+
+// jsonEntry is the JSON form of a log entry written to stderr.
+type jsonEntry struct {
+	Timestamp   string `json:"timestamp"`
+	Severity    string `json:"severity"`
+	Instruction string `json:"instruction,omitempty"`
+	Transform   string `json:"transform,omitempty"`
+	Thread      string `json:"thread,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Message     string `json:"message"`
+	Trace       string `json:"trace,omitempty"`
+}
+
+// formatFallback returns the entry as a line to write to stderr, when it
+// can't be sent. Plain lines are prefixed by the severity, so that a dropped
+// error stands out from a dropped debug message, and colorized by severity if
+// color is set.
+func formatFallback(entry *pb.LogEntry, format fallbackFormat, color bool) string {
+	if format == fallbackJSON {
+		return formatJSON(entry)
+	}
+	line := severityPrefix(entry.GetSeverity()) + entry.GetMessage()
+	if color {
+		return colorize(line, entry.GetSeverity())
+	}
+	return line
+}
+
+// severityPrefix returns the prefix of plain lines of the severity, such as
+// "INFO: ", or "" if it is unspecified. Errors and critical entries are
+// marked, since they would otherwise be easily missed among the others.
+func severityPrefix(sev pb.LogEntry_Severity_Enum) string {
+	switch sev {
+	case pb.LogEntry_Severity_UNSPECIFIED:
+		return ""
+	case pb.LogEntry_Severity_ERROR, pb.LogEntry_Severity_CRITICAL:
+		return "*** " + sev.String() + ": "
+	default:
+		return sev.String() + ": "
+	}
+}
+
+// ANSI escape sequences of the colors used for severities.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiGray   = "\x1b[90m"
+)
+
+// colorEnabled returns whether output to a file of the given mode should be
+// colorized. Only character devices, such as terminals, are colorized, unless
+// disabled by a non-empty NO_COLOR environment variable value.
+func colorEnabled(mode os.FileMode, noColor string) bool {
+	return mode&os.ModeCharDevice != 0 && noColor == ""
+}
+
+// fallbackColor returns whether output to the fallback writer, stderr if
+// nil, should be colorized. Only files can be terminals.
+func fallbackColor(w io.Writer) bool {
+	f := os.Stderr
+	if w != nil {
+		var ok bool
+		if f, ok = w.(*os.File); !ok {
+			return false
+		}
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return colorEnabled(fi.Mode(), os.Getenv("NO_COLOR"))
+}
+
+// fallback returns the writer of the entries that can't be buffered.
+func (l *logger) fallback() io.Writer {
+	if l.stderr == nil {
+		return os.Stderr
+	}
+	return l.stderr
+}
+
+// fallback returns the writer of the entries that can't be sent, and of the
+// reports of failures.
+func (w *remoteWriter) fallback() io.Writer {
+	if w.stderr == nil {
+		return os.Stderr
+	}
+	return w.stderr
+}
+
+// severityColor returns the ANSI escape sequence of the color for the
+// severity, or "" if it isn't colored.
+func severityColor(sev pb.LogEntry_Severity_Enum) string {
+	switch sev {
+	case pb.LogEntry_Severity_ERROR, pb.LogEntry_Severity_CRITICAL:
+		return ansiRed
+	case pb.LogEntry_Severity_WARN:
+		return ansiYellow
+	case pb.LogEntry_Severity_DEBUG, pb.LogEntry_Severity_TRACE:
+		return ansiGray
+	default:
+		return ""
+	}
+}
+
+// colorize wraps the line in the color of the severity, if any.
+func colorize(line string, sev pb.LogEntry_Severity_Enum) string {
+	c := severityColor(sev)
+	if c == "" {
+		return line
+	}
+	return c + line + ansiReset
+}
+
+// entryTime returns the time of the entry, or the current time if its
+// timestamp is missing or invalid, as for an entry built by a Sink user.
+func entryTime(entry *pb.LogEntry) time.Time {
+	t, err := ptypes.Timestamp(entry.GetTimestamp())
+	if err != nil {
+		return time.Now()
+	}
+	return t
+}
+
+// formatJSON returns the entry as a single line JSON object.
+func formatJSON(entry *pb.LogEntry) string {
+	b, err := json.Marshal(jsonEntry{
+		Timestamp:   entryTime(entry).UTC().Format(time.RFC3339Nano),
+		Severity:    entry.GetSeverity().String(),
+		Instruction: entry.GetInstructionReference(),
+		Transform:   entry.GetPrimitiveTransformReference(),
+		Thread:      entry.GetThread(),
+		Location:    entry.GetLogLocation(),
+		Message:     entry.GetMessage(),
+		Trace:       entry.GetTrace(),
+	})
+	if err != nil {
+		// Only strings are marshaled, so this isn't expected.
+		return entry.GetMessage()
+	}
+	return string(b)
+}
+
+// stderrSink is a Sink that writes entries to stderr. It is used if there
+// is no usable FnLogging endpoint.
+type stderrSink struct {
+	format fallbackFormat
+	// color colorizes plain lines by severity.
+	color bool
+	// out, if set, is written to instead of os.Stderr.
+	out io.Writer
+}
+
+func (s stderrSink) Send(list *pb.LogEntry_List) error {
+	out := s.out
+	if out == nil {
+		out = os.Stderr
+	}
+	for _, e := range list.GetLogEntries() {
+		if s.format == fallbackJSON {
+			fmt.Fprintln(out, formatJSON(e))
+			continue
+		}
+
+		line := entryTime(e).Local().Format("2006/01/02 15:04:05") + " " + severityPrefix(e.GetSeverity())
+		if loc := e.GetLogLocation(); loc != "" {
+			line += loc + ": "
+		}
+		line += e.GetMessage()
+		if s.color {
+			line = colorize(line, e.GetSeverity())
+		}
+		fmt.Fprintln(out, line)
+		if e.GetTrace() != "" {
+			fmt.Fprintln(out, e.GetTrace())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+)
+
+func TestFormatFallback(t *testing.T) {
+	entry := newEntry(time.Date(2018, 5, 1, 12, 30, 0, 0, time.UTC), pb.LogEntry_Severity_ERROR, `bad "input"`)
+	entry.InstructionReference = "inst1"
+	entry.LogLocation = "harness/logging.go:42"
+
+	if got, want := formatFallback(entry, fallbackPlain, false), `*** ERROR: bad "input"`; got != want {
+		t.Errorf("formatFallback(plain) = %v, want %v", got, want)
+	}
+	want := `{"timestamp":"2018-05-01T12:30:00Z","severity":"ERROR","instruction":"inst1","location":"harness/logging.go:42","message":"bad \"input\""}`
+	if got := formatFallback(entry, fallbackJSON, true); got != want {
+		t.Errorf("formatFallback(json) = %v, want %v", got, want)
+	}
+}
+
+func TestFormatFallbackInvalidTimestamp(t *testing.T) {
+	entry := &pb.LogEntry{Severity: pb.LogEntry_Severity_INFO, Message: "no time"}
+
+	// An entry without a valid timestamp is written at the current time.
+	before := time.Now().UTC().Add(-time.Second)
+	var got jsonEntry
+	if err := json.Unmarshal([]byte(formatJSON(entry)), &got); err != nil {
+		t.Fatalf("formatJSON(%v) isn't valid JSON: %v", entry, err)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, got.Timestamp)
+	if err != nil || ts.Before(before) {
+		t.Errorf("timestamp = %q, want the current time", got.Timestamp)
+	}
+}
+
+func TestSeverityPrefix(t *testing.T) {
+	tests := []struct {
+		sev  pb.LogEntry_Severity_Enum
+		want string
+	}{
+		{pb.LogEntry_Severity_CRITICAL, "*** CRITICAL: "},
+		{pb.LogEntry_Severity_ERROR, "*** ERROR: "},
+		{pb.LogEntry_Severity_WARN, "WARN: "},
+		{pb.LogEntry_Severity_DEBUG, "DEBUG: "},
+		{pb.LogEntry_Severity_UNSPECIFIED, ""},
+	}
+	for _, test := range tests {
+		if got := severityPrefix(test.sev); got != test.want {
+			t.Errorf("severityPrefix(%v) = %q, want %q", test.sev, got, test.want)
+		}
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		mode    os.FileMode
+		noColor string
+		want    bool
+	}{
+		{os.ModeDevice | os.ModeCharDevice, "", true},
+		{os.ModeDevice | os.ModeCharDevice, "1", false},
+		{0, "", false}, // regular file
+		{os.ModeNamedPipe, "", false},
+	}
+	for _, test := range tests {
+		if got := colorEnabled(test.mode, test.noColor); got != test.want {
+			t.Errorf("colorEnabled(%v, %q) = %v, want %v", test.mode, test.noColor, got, test.want)
+		}
+	}
+}
+
+func TestColorize(t *testing.T) {
+	tests := []struct {
+		sev  pb.LogEntry_Severity_Enum
+		want string
+	}{
+		{pb.LogEntry_Severity_CRITICAL, "\x1b[31mmsg\x1b[0m"},
+		{pb.LogEntry_Severity_ERROR, "\x1b[31mmsg\x1b[0m"},
+		{pb.LogEntry_Severity_WARN, "\x1b[33mmsg\x1b[0m"},
+		{pb.LogEntry_Severity_INFO, "msg"},
+		{pb.LogEntry_Severity_DEBUG, "\x1b[90mmsg\x1b[0m"},
+	}
+	for _, test := range tests {
+		if got := colorize("msg", test.sev); got != test.want {
+			t.Errorf("colorize(%v) = %q, want %q", test.sev, got, test.want)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be written concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLogFallbackWriter(t *testing.T) {
+	var out syncBuffer
+	l := &logger{out: make(chan *pb.LogEntry, 1), stats: &logStats{}, stderr: &out}
+
+	ctx := context.Background()
+	l.Log(ctx, log.SevInfo, 1, "buffered")
+	l.Log(ctx, log.SevInfo, 1, "dropped")
+	if got, want := out.String(), "INFO: dropped\n"; got != want {
+		t.Errorf("fallback output = %q, want %q", got, want)
+	}
+}
+
+func TestLogFallbackWriterDisabled(t *testing.T) {
+	var out syncBuffer
+	ctx := context.Background()
+	r := Start(ctx, "", Options{FallbackWriter: &out})
+	log.Info(ctx, "to fallback")
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for _, want := range []string{"Remote logging disabled", "to fallback"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("fallback output %q doesn't contain %q", out.String(), want)
+		}
+	}
+}
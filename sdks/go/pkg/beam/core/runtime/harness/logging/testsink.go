@@ -0,0 +1,34 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+)
+
+// UseSink installs a logger that writes the messages logged with the log
+// package to the sink, until the returned function is called, which restores
+// the logger installed before. Each message is written before the logging
+// call returns. It lets DoFns run outside of a worker, such as by unit tests,
+// log as they do on a worker; see the harnesstest package. The logger is
+// global, so it must not be used concurrently.
+func UseSink(s Sink) func() {
+	ctx := context.Background()
+	r := Start(ctx, "", Options{Sink: s, synchronous: true})
+	return func() {
+		r.Close(ctx)
+	}
+}
@@ -0,0 +1,45 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+)
+
+func TestUseSink(t *testing.T) {
+	prev := log.GetLogger()
+	sink := &collectSink{}
+	restore := UseSink(sink)
+
+	ctx := context.Background()
+	log.Info(ctx, "to the sink")
+
+	// The message is written before Info returns.
+	sink.mu.Lock()
+	n := len(sink.entries)
+	sink.mu.Unlock()
+	if n != 1 {
+		t.Errorf("sink received %v entries, want 1", n)
+	}
+
+	restore()
+	if log.GetLogger() != prev {
+		t.Errorf("logger not restored")
+	}
+}
@@ -0,0 +1,788 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam/log"
+	pb "github.com/apache/beam/sdks/go/pkg/beam/model/fnexecution_v1"
+	"github.com/apache/beam/sdks/go/pkg/beam/util/grpcx"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+// remoteWriter sends the buffered entries, in batches, on a single goroutine.
+//
+// Entries of the same severity class, below WARN or WARN and above, are sent
+// in the order they were logged, including across reconnects: a batch that
+// failed to send is sent again before any later entry. Entries of different
+// classes may be reordered, since the priority buffer is drained first. WARN
+// entries that overflow the priority buffer go to the regular buffer, so they
+// may be sent after later WARN entries. Entries logged concurrently are
+// ordered by when they were buffered.
+type remoteWriter struct {
+	buffer chan *pb.LogEntry
+	// priority holds entries of WARN severity or above. It is drained
+	// before buffer.
+	priority chan *pb.LogEntry
+	// flushes carries requests to send all buffered entries right away. The
+	// outcome is reported on the request channel.
+	flushes chan chan error
+	// freed is signalled as entries are taken from the buffers, to wake an
+	// entry waiting for room. See logger.await.
+	freed    chan struct{}
+	stats    *logStats
+	endpoint string
+	// sink, if set, is written to instead of a stream to the endpoint.
+	sink Sink
+	// dialOptions, if set, are used to connect to the endpoint.
+	dialOptions []grpc.DialOption
+	// hooks are called with each batch before it is sent.
+	hooks []EntriesHook
+	// diagnostics, if set, receives each failure, unless it is full.
+	diagnostics chan<- error
+
+	// batchSize is the maximum number of entries sent in one LogEntry_List.
+	batchSize int
+	// maxBatchBytes, if positive, is the maximum serialized size of a
+	// LogEntry_List, beyond which a batch is split.
+	maxBatchBytes int
+	// flushInterval is the maximum time a partial batch is held before it
+	// is sent, so that low log volume doesn't delay entries indefinitely.
+	flushInterval time.Duration
+	// dialTimeout bounds each attempt to connect to the endpoint.
+	dialTimeout time.Duration
+	// maxRetries, if positive, is the number of consecutive failed
+	// reconnects after which the endpoint is given up for stderr.
+	maxRetries int
+	// sendTimeout bounds each send on the stream, if positive.
+	sendTimeout time.Duration
+	// compress enables gzip compression of the stream.
+	compress bool
+	// keepalive configures the pings on the connection, if its Time is
+	// positive.
+	keepalive keepalive.ClientParameters
+	// backoffBase is the delay before reconnecting after a failure. It
+	// doubles with each consecutive failure, up to backoffMax.
+	backoffBase, backoffMax time.Duration
+
+	// backoff is the delay before the next reconnect attempt. Only accessed
+	// by the Run goroutine.
+	backoff time.Duration
+	// connected is when the last stream was established, if any. Only
+	// accessed by the Run goroutine.
+	connected time.Time
+	// failures is the number of reconnect failures since the last successful
+	// connection, the last of which was lastFailure. Only accessed by the Run
+	// goroutine, as are failingSince and lastReport.
+	failures     int
+	lastFailure  string
+	failingSince time.Time
+	lastReport   time.Time
+	// announced is set once a stream to the endpoint is established, which
+	// is announced by an entry, and cleared when an attempt to establish one
+	// fails. A stream reestablished right after the previous one failed
+	// isn't announced. Only accessed by the Run goroutine.
+	announced bool
+	// reportedDrops is the number of dropped entries already reported. Only
+	// accessed by the Run goroutine.
+	reportedDrops int64
+	// healthInterval, if positive, is how often the writer logs a summary of
+	// its health, as of health. sent and reconnects are the entries sent and
+	// the reconnect attempts so far. Only accessed by the Run goroutine.
+	healthInterval time.Duration
+	health         healthCounts
+	sent           int64
+	reconnects     int64
+	// sweep, if set, reports the repeats of the messages whose
+	// deduplication window has closed. It is called every flushInterval.
+	sweep func(context.Context)
+	// pending holds entries taken from the buffer, but not yet sent, when
+	// connect returns. They are sent first on the next connection, or by
+	// drain. Only accessed by the Run goroutine.
+	pending []*pb.LogEntry
+	// sendFailures is the number of consecutive failed attempts to send the
+	// pending entries. Only accessed by the Run goroutine.
+	sendFailures int
+	// atLeastOnce holds the entries sent on a stream in inFlight, to be
+	// sent again if it fails, and keeps retrying the batches that fail to
+	// be sent. inFlight is only accessed by the Run goroutine.
+	atLeastOnce bool
+	inFlight    []*pb.LogEntry
+	// closedByRunner is set once the runner closed the stream, until the
+	// attempt to reestablish it right away ends. Only accessed by the Run
+	// goroutine.
+	closedByRunner bool
+	// fallbackFormat and color control how entries that can't be sent are
+	// written to stderr, or stderr if set.
+	fallbackFormat fallbackFormat
+	color          bool
+	stderr         io.Writer
+	// severities, if set, maps the severities of the entries of the writer
+	// itself, instead of convertSeverity.
+	severities SeverityMapping
+	// cc is the connection to the endpoint, which is kept across streams
+	// until it breaks. Only accessed by the Run goroutine.
+	cc *grpc.ClientConn
+	// warnedKeepalive is set once the writer has reported that the keepalive
+	// parameters can't be applied by the customized dialer. Only accessed by
+	// the Run goroutine.
+	warnedKeepalive bool
+	// cancelStream aborts the current stream, if any. It is used to unblock
+	// a send that exceeds sendTimeout. Only accessed by the Run goroutine.
+	cancelStream context.CancelFunc
+	// recycle is set while writing to the FnLogging stream, which marshals a
+	// batch before Send returns, so that sent entries can be released to
+	// entryPool. A Sink may retain the entries, so it is not set for
+	// sinks. Only accessed by the Run goroutine.
+	recycle bool
+}
+
+// Run sends buffered entries to the FnLogging service, or the sink if set,
+// reconnecting if needed, until the context is cancelled. It then drains the
+// buffer and returns ctx.Err(). If the buffer is closed instead, Run returns
+// nil once the remaining entries are sent.
+func (w *remoteWriter) Run(ctx context.Context) error {
+	defer w.closeConn()
+	for {
+		w.connected = time.Time{}
+		err := w.connect(ctx)
+		if err == errBufferClosed {
+			return nil
+		}
+		w.requeue(ctx, err)
+		if ctx.Err() != nil {
+			w.drain(ctx)
+			return ctx.Err()
+		}
+
+		if w.connected.IsZero() {
+			w.announced = false
+		} else {
+			if time.Since(w.connected) >= backoffResetAfter {
+				w.backoff = 0
+			}
+			w.failures = 0
+		}
+		// If reestablishing the stream closed by the runner failed, or it
+		// was closed again right away, the runner may be shutting down or
+		// restarting, so it is retried with backoff, as for a failure, until
+		// ctx is done or maxRetries is reached.
+		again := w.closedByRunner && (w.connected.IsZero() || time.Since(w.connected) < backoffResetAfter)
+		w.closedByRunner = false
+		if err == errStreamClosed && !again {
+			// Unlike a failure, this is reestablished once, right away.
+			w.closedByRunner = true
+			fmt.Fprintln(w.fallback(), "Remote logging stream closed by the runner. Reconnecting ...")
+			continue
+		}
+		if w.maxRetries > 0 && w.failures >= w.maxRetries {
+			w.giveUp(err)
+			continue
+		}
+		delay := w.nextBackoff()
+		w.reportFailure(err, delay)
+		loggingReconnects.Inc(loggingMetricsCtx, 1)
+		w.reconnects++
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			w.drain(ctx)
+			return ctx.Err()
+		}
+	}
+}
+
+// connect opens a stream to the endpoint, unless a sink is set, and writes
+// entries to it until an error occurs or ctx is cancelled.
+func (w *remoteWriter) connect(ctx context.Context) error {
+	if w.sink != nil {
+		w.connected = time.Now()
+		w.stats.setError(nil)
+		loggingConnected.Set(loggingMetricsCtx, 1)
+		defer loggingConnected.Set(loggingMetricsCtx, 0)
+		return w.write(ctx, w.sink)
+	}
+
+	conn, err := w.conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client, err := pb.NewBeamFnLoggingClient(conn).Logging(sctx, w.callOptions()...)
+	if err != nil {
+		w.checkConn()
+		return err
+	}
+	// The connection outlives a failed stream, unless it is broken too.
+	defer w.checkConn()
+	defer client.CloseSend()
+	w.connected = time.Now()
+	w.stats.setError(nil)
+	loggingConnected.Set(loggingMetricsCtx, 1)
+	defer loggingConnected.Set(loggingMetricsCtx, 0)
+
+	if !w.announced {
+		// Confirm the path to the runner is live, and the endpoint used,
+		// ahead of the newer entries.
+		msg := fmt.Sprintf("Remote logging established to %v", w.endpoint)
+		w.pending = append(w.pending, newEntry(w.connected, w.severity(log.SevInfo), msg))
+		w.announced = true
+	}
+
+	w.cancelStream = cancel
+	// Entries held in flight may be sent again, so they aren't released.
+	w.recycle = !w.atLeastOnce
+	defer func() { w.cancelStream, w.recycle = nil, false }()
+
+	// The stream is cancelled once connect returns, which ends the receive
+	// loop.
+	status := make(chan error, 1)
+	go func() { status <- receiveStatus(client) }()
+
+	err = w.write(ctx, client)
+	if err != io.EOF {
+		return err
+	}
+	// Send only reports that the stream ended. Its status is returned by
+	// Recv: io.EOF if the runner ended it cleanly.
+	select {
+	case serr := <-status:
+		if serr == io.EOF {
+			return errStreamClosed
+		}
+		return serr
+	case <-time.After(streamStatusTimeout):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// conn returns the connection to the endpoint, dialing it if there is none,
+// since the previous one broke.
+func (w *remoteWriter) conn(ctx context.Context) (*grpc.ClientConn, error) {
+	if w.cc != nil {
+		return w.cc, nil
+	}
+	cc, err := w.dial(ctx, w.dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	w.cc = cc
+	return cc, nil
+}
+
+// checkConn closes the connection if it is broken, after a stream on it
+// ended, so that it is re-dialed for the next stream. A connection that is
+// still usable, such as one on which the runner merely ended the stream, is
+// kept, which spares a new handshake under flapping conditions.
+func (w *remoteWriter) checkConn() {
+	if w.cc == nil {
+		return
+	}
+	switch w.cc.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		w.closeConn()
+	}
+}
+
+// closeConn closes the connection, if any.
+func (w *remoteWriter) closeConn() {
+	if w.cc != nil {
+		w.cc.Close()
+		w.cc = nil
+	}
+}
+
+// receiveStatus reads the stream until it fails or is closed, and returns
+// its status. The control messages sent by the runner are discarded, since
+// LogControl doesn't define any fields yet, such as a minimum severity.
+func receiveStatus(client pb.BeamFnLogging_LoggingClient) error {
+	for {
+		if _, err := client.Recv(); err != nil {
+			return err
+		}
+	}
+}
+
+// write sends buffered entries to the sink until an error occurs or ctx is
+// cancelled.
+func (w *remoteWriter) write(ctx context.Context, sink Sink) error {
+	// A batch is sent once it holds batchSize entries or once flushInterval
+	// has elapsed since its first entry was added, whichever comes first.
+	drops := time.NewTicker(dropReportInterval)
+	defer drops.Stop()
+	health := w.healthTimer()
+	var sweep <-chan time.Time
+	if w.sweep != nil {
+		t := time.NewTicker(w.flushInterval)
+		defer t.Stop()
+		sweep = t.C
+	}
+
+	batch := w.pending
+	w.pending = nil
+	var flush <-chan time.Time // non-nil only while a partial batch is pending
+	if len(batch) > 0 {
+		flush = time.After(w.flushInterval)
+	}
+	for {
+		select {
+		case <-drops.C:
+			n := atomic.LoadInt64(&w.stats.dropped)
+			if n == w.reportedDrops {
+				continue
+			}
+			msg := fmt.Sprintf("Dropped %v log entries due to buffer pressure or failed sends", n-w.reportedDrops)
+			batch = append(batch, newEntry(time.Now(), w.severity(log.SevWarn), msg))
+			w.reportedDrops = n
+		case <-health:
+			batch = append(batch, w.healthReport(time.Now()))
+			health = w.healthTimer()
+		case <-sweep:
+			// The repeats are buffered, and taken in turn. They are
+			// never waited for, since the writer would wait on itself.
+			w.sweep(ctx)
+			continue
+		case msg := <-w.priority:
+			batch = w.take(batch, msg)
+		case msg, ok := <-w.buffer:
+			if !ok {
+				return w.closed(sink, batch)
+			}
+			batch = w.take(batch, msg)
+		case <-flush:
+			if err := w.send(sink, batch); err != nil {
+				return err
+			}
+			batch, flush = nil, nil
+			continue
+		case done := <-w.flushes:
+			err := w.sendAll(sink, batch)
+			done <- err
+			if err != nil {
+				return err
+			}
+			batch, flush = nil, nil
+			continue
+		case <-ctx.Done():
+			// The stream is cancelled along with ctx, so the batch is
+			// left for drain.
+			w.pending = batch
+			return ctx.Err()
+		}
+
+		// Top up the batch with whatever else is available and send it once
+		// it is full.
+		var open bool
+		batch, open = w.fill(batch)
+		if !open {
+			return w.closed(sink, batch)
+		}
+		if len(batch) < w.batchSize {
+			if flush == nil {
+				flush = time.After(w.flushInterval)
+			}
+			continue
+		}
+		if err := w.send(sink, batch); err != nil {
+			return err
+		}
+		batch, flush = nil, nil
+	}
+}
+
+// callOptions returns the options of the FnLogging stream.
+func (w *remoteWriter) callOptions() []grpc.CallOption {
+	if w.compress {
+		return []grpc.CallOption{grpc.UseCompressor(gzip.Name)}
+	}
+	return nil
+}
+
+// dial connects to the endpoint, with the dial options if any are set. Unlike
+// the dial of the control connection, it doesn't log.
+func (w *remoteWriter) dial(ctx context.Context, timeout time.Duration) (*grpc.ClientConn, error) {
+	var extra []grpc.DialOption
+	if w.keepalive.Time > 0 {
+		extra = append(extra, grpc.WithKeepaliveParams(w.keepalive))
+	}
+	path, unix := unixSocketPath(w.endpoint)
+	if unix {
+		extra = append(extra, grpc.WithDialer(func(_ string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", path, timeout)
+		}))
+	}
+	// Nothing is logged here, since the entry would only be sent by this
+	// writer, once connected. The connection is announced once established,
+	// and failures are reported to stderr.
+	if len(w.dialOptions) == 0 {
+		cc, err := grpcx.DialWithOptions(ctx, w.endpoint, timeout, extra...)
+		if err != grpcx.ErrDialOptions {
+			return cc, err
+		}
+		if unix {
+			return nil, fmt.Errorf("failed to dial server at %v: %v", w.endpoint, err)
+		}
+		// A customized dialer, such as one installed by a runner, that
+		// can't apply the keepalive parameters is used without them.
+		if !w.warnedKeepalive {
+			fmt.Fprintln(w.fallback(), "Remote logging keepalive disabled, since the customized dialer doesn't support it")
+			w.warnedKeepalive = true
+		}
+		return grpcx.Dial(ctx, w.endpoint, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opts := append([]grpc.DialOption{grpc.WithBlock()}, w.dialOptions...)
+	opts = append(opts, extra...)
+	cc, err := grpc.DialContext(ctx, w.endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial server at %v: %v", w.endpoint, err)
+	}
+	return cc, nil
+}
+
+// errBufferClosed is returned by connect once the buffer is closed and the
+// remaining entries are sent. Closing the buffer is an intentional shutdown,
+// so Run then returns rather than reconnecting.
+var errBufferClosed = errors.New("log buffer closed")
+
+// errStreamClosed is returned by connect if the runner ended the stream
+// cleanly, rather than with an error, such as when it shuts down.
+var errStreamClosed = errors.New("logging stream closed by the runner")
+
+// streamStatusTimeout bounds how long connect waits for the status of a stream
+// that ended.
+const streamStatusTimeout = time.Second
+
+// closed sends the final batch, along with any entries left in the priority
+// buffer, once the buffer has been closed.
+func (w *remoteWriter) closed(sink Sink, batch []*pb.LogEntry) error {
+	if err := w.sendAll(sink, batch); err != nil {
+		return err
+	}
+	return errBufferClosed
+}
+
+// reportFailure writes a reconnect failure to stderr. Consecutive identical
+// failures are collapsed into a periodic summary, until a connection succeeds.
+func (w *remoteWriter) reportFailure(err error, delay time.Duration) {
+	w.observe(err)
+	now := time.Now()
+	if w.failures == 0 {
+		w.failingSince = now
+	}
+	w.failures++
+
+	switch {
+	case w.failures == 1 || err.Error() != w.lastFailure:
+		fmt.Fprintf(w.fallback(), "Remote logging failed: %v. Retrying in %v ...\n", err, delay)
+	case now.Sub(w.lastReport) >= failureReportInterval:
+		fmt.Fprintf(w.fallback(), "Remote logging still failing (%v attempts over %v): %v\n", w.failures, now.Sub(w.failingSince).Round(time.Second), err)
+	default:
+		return
+	}
+	w.lastFailure = err.Error()
+	w.lastReport = now
+}
+
+// giveUp stops reconnecting to the endpoint once maxRetries consecutive
+// attempts failed, after the last error err. The entries are written to stderr
+// from then on, starting with a warning about it.
+func (w *remoteWriter) giveUp(err error) {
+	w.observe(err)
+	w.useStderr(fmt.Sprintf("Remote logging gave up after %v failed attempts over %v: %v. Logging to stderr.", w.failures+1, time.Since(w.failingSince).Round(time.Second), err))
+}
+
+// useStderr writes the entries to stderr from now on, starting with a warning
+// with the message.
+func (w *remoteWriter) useStderr(msg string) {
+	w.pending = append(w.pending, newEntry(time.Now(), w.severity(log.SevWarn), msg))
+	w.sink = stderrSink{format: w.fallbackFormat, color: w.color, out: w.stderr}
+	w.closeConn()
+}
+
+// nextBackoff returns the delay before the next reconnect attempt, with +/-20%
+// jitter, and doubles the delay used for the attempt after that.
+func (w *remoteWriter) nextBackoff() time.Duration {
+	if w.backoff == 0 {
+		w.backoff = w.backoffBase
+	}
+	d := w.backoff
+
+	w.backoff *= 2
+	if w.backoff > w.backoffMax {
+		w.backoff = w.backoffMax
+	}
+	jitter := (rand.Float64()*0.4 - 0.2) * float64(d)
+	return d + time.Duration(jitter)
+}
+
+// drain sends the pending entries along with the entries remaining in the
+// buffer to the sink, if set, or on a fresh connection, bounded by
+// drainTimeout. It is used once ctx is cancelled, so only the metadata of ctx
+// is retained.
+func (w *remoteWriter) drain(ctx context.Context) {
+	if len(w.pending) == 0 && len(w.buffer) == 0 && len(w.priority) == 0 {
+		return
+	}
+
+	dctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		dctx = metadata.NewOutgoingContext(dctx, md)
+	}
+
+	err := func() error {
+		if w.sink != nil {
+			batch := w.pending
+			w.pending = nil
+			return w.sendAll(w.sink, batch)
+		}
+
+		// The connection of the last stream is reused, if still usable.
+		w.checkConn()
+		conn := w.cc
+		if conn == nil {
+			var err error
+			if conn, err = w.dial(dctx, drainTimeout); err != nil {
+				return err
+			}
+			defer conn.Close()
+		}
+
+		client, err := pb.NewBeamFnLoggingClient(conn).Logging(dctx, w.callOptions()...)
+		if err != nil {
+			return err
+		}
+		defer client.CloseSend()
+
+		batch := w.pending
+		w.pending = nil
+		return w.sendAll(client, batch)
+	}()
+	if err != nil {
+		fmt.Fprintf(w.fallback(), "Failed to drain remote logging: %v\n", err)
+		w.spill()
+	}
+}
+
+// take adds an entry received from the buffers to the batch, releasing its
+// share of the buffered bytes.
+func (w *remoteWriter) take(batch []*pb.LogEntry, entry *pb.LogEntry) []*pb.LogEntry {
+	atomic.AddInt64(&w.stats.bufferedBytes, -entrySize(entry))
+	signalFreed(w.freed)
+	return append(batch, entry)
+}
+
+// fill adds entries that are immediately available in the buffers to the
+// batch, without blocking, until the batch is full. Priority entries are taken
+// first. It returns false if the buffer was closed.
+func (w *remoteWriter) fill(batch []*pb.LogEntry) ([]*pb.LogEntry, bool) {
+	for len(batch) < w.batchSize {
+		select {
+		case msg := <-w.priority:
+			batch = w.take(batch, msg)
+			continue
+		default:
+		}
+
+		select {
+		case msg, ok := <-w.buffer:
+			if !ok {
+				return batch, false
+			}
+			batch = w.take(batch, msg)
+		default:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// retry keeps a batch that failed to send, to be sent first on the next
+// connection. The failure is likely transient, such as a broken stream, but a
+// batch that fails maxSendAttempts times in a row is dropped instead, so that
+// an entry the runner always rejects can't block logging indefinitely, unless
+// delivery is at least once.
+func (w *remoteWriter) retry(batch []*pb.LogEntry) {
+	w.sendFailures++
+	if w.sendFailures < maxSendAttempts || w.atLeastOnce {
+		w.pending = batch
+		return
+	}
+	w.pending, w.sendFailures = nil, 0
+	fmt.Fprintf(w.fallback(), "Dropping %v log entries after %v failed send attempts\n", len(batch), maxSendAttempts)
+	w.discard(batch)
+}
+
+// discard counts the entries as dropped and writes them to stderr instead.
+func (w *remoteWriter) discard(entries []*pb.LogEntry) {
+	atomic.AddInt64(&w.stats.dropped, int64(len(entries)))
+	loggingDropped.Inc(loggingMetricsCtx, int64(len(entries)))
+	for _, entry := range entries {
+		fmt.Fprintln(w.fallback(), formatFallback(entry, w.fallbackFormat, w.color))
+		if w.recycle {
+			releaseEntry(entry)
+		}
+	}
+}
+
+// spill discards the pending entries and those remaining in the buffers, once
+// they can't be sent.
+func (w *remoteWriter) spill() {
+	batch := w.pending
+	w.pending = nil
+	for {
+		select {
+		case entry := <-w.priority:
+			batch = w.take(batch, entry)
+			continue
+		case entry, ok := <-w.buffer:
+			if ok {
+				batch = w.take(batch, entry)
+				continue
+			}
+		default:
+		}
+		break
+	}
+	w.discard(batch)
+}
+
+// sendAll sends the batch along with all entries currently in the buffer.
+func (w *remoteWriter) sendAll(sink Sink, batch []*pb.LogEntry) error {
+	for {
+		var open bool
+		batch, open = w.fill(batch)
+		if err := w.send(sink, batch); err != nil {
+			return err
+		}
+		if !open || len(batch) < w.batchSize {
+			return nil
+		}
+		batch = nil
+	}
+}
+
+// send sends the batch in as few LogEntry_Lists as fit in maxBatchBytes. If a
+// list fails to be sent, it is retried along with the rest of the batch.
+func (w *remoteWriter) send(sink Sink, batch []*pb.LogEntry) error {
+	for len(batch) > 0 {
+		n := w.split(batch)
+		if err := w.sendList(sink, batch[:n]); err != nil {
+			w.retry(batch)
+			return err
+		}
+		batch = batch[n:]
+	}
+	return nil
+}
+
+// split returns the number of leading entries of the batch whose list fits in
+// maxBatchBytes, if set. An entry that exceeds it by itself is sent alone.
+func (w *remoteWriter) split(batch []*pb.LogEntry) int {
+	if w.maxBatchBytes <= 0 {
+		return len(batch)
+	}
+	size := 0
+	for i, entry := range batch {
+		size += listEntrySize(entry)
+		if size > w.maxBatchBytes && i > 0 {
+			return i
+		}
+	}
+	return len(batch)
+}
+
+// listEntrySize returns the serialized size of the entry within a
+// LogEntry_List, including its tag and length prefix.
+func listEntrySize(entry *pb.LogEntry) int {
+	n := proto.Size(entry)
+	return 1 + proto.SizeVarint(uint64(n)) + n
+}
+
+// sendList sends the entries as a single LogEntry_List.
+func (w *remoteWriter) sendList(sink Sink, batch []*pb.LogEntry) error {
+	list := &pb.LogEntry_List{
+		LogEntries: batch,
+	}
+
+	for _, hook := range w.hooks {
+		hook(list)
+	}
+
+	// A stalled stream is aborted once sendTimeout elapses. The send is only
+	// reported as timed out if it failed, since it may have completed just
+	// as the timer fired, in which case the batch was sent.
+	var timer *time.Timer
+	var timedOut int32
+	if w.cancelStream != nil && w.sendTimeout > 0 {
+		cancel := w.cancelStream
+		timer = time.AfterFunc(w.sendTimeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			cancel()
+		})
+	}
+	start := time.Now()
+	err := sink.Send(list)
+	latency := time.Since(start)
+	if timer != nil {
+		timer.Stop()
+		if err != nil && atomic.LoadInt32(&timedOut) != 0 {
+			err = fmt.Errorf("send timed out after %v: %v", w.sendTimeout, err)
+		}
+	}
+	if err != nil {
+		loggingSendFailures.Inc(loggingMetricsCtx, 1)
+		// io.EOF means that the stream ended, which connect reports.
+		if err != io.EOF {
+			fmt.Fprintf(w.fallback(), "Failed to send %v log entries: %v\n", len(batch), err)
+		}
+		return err
+	}
+	loggingSends.Inc(loggingMetricsCtx, 1)
+	w.sent += int64(len(batch))
+	loggingBatchSize.Update(loggingMetricsCtx, int64(len(batch)))
+	loggingSendLatency.Update(loggingMetricsCtx, int64(latency/time.Microsecond))
+	w.sendFailures = 0
+	w.hold(batch)
+	if w.recycle {
+		for _, entry := range batch {
+			releaseEntry(entry)
+		}
+	}
+	return nil
+}
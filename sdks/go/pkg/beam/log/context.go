@@ -0,0 +1,218 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type contextKey string
+
+const (
+	fieldsKey      contextKey = "beam:log:fields"
+	defaultsKey    contextKey = "beam:log:defaults"
+	instructionKey contextKey = "beam:inst"
+	eventTimeKey   contextKey = "beam:log:eventtime"
+)
+
+// WithInstructionID returns a context annotated with the ID of the instruction
+// being processed, which loggers can attach to messages. It replaces the
+// instructions of ctx, including those pushed with PushInstructionID.
+func WithInstructionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(orBackground(ctx), instructionKey, &instruction{id: id})
+}
+
+// InstructionID returns the ID of the instruction being processed, if the
+// context is annotated with one, which is the innermost instruction that
+// hasn't been popped.
+func InstructionID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	inst, _ := ctx.Value(instructionKey).(*instruction)
+	for ; inst != nil; inst = inst.parent {
+		if atomic.LoadInt32(&inst.popped) == 0 {
+			return inst.id, true
+		}
+	}
+	return "", false
+}
+
+// instruction is an instruction being processed, nested in its parent, if
+// any.
+type instruction struct {
+	id     string
+	parent *instruction
+	// popped is set, atomically, once the instruction is popped.
+	popped int32
+}
+
+// orBackground returns ctx, or context.Background() if ctx is nil, so that,
+// like the loggers, the helpers deriving a context accept a nil one.
+func orBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// PushInstructionID makes id the instruction being processed with the
+// returned context, nested in the instruction of ctx, until pop is called,
+// which restores the outer instruction. It is meant for a goroutine that
+// processes nested instructions, such as in fused execution:
+//
+//	ctx, pop := log.PushInstructionID(ctx, id)
+//	defer pop()
+//
+// Only the contexts derived from the returned one see the push and the pop,
+// so that contexts pushed from the same one, such as by sibling goroutines,
+// don't affect each other.
+func PushInstructionID(ctx context.Context, id string) (context.Context, func()) {
+	ctx = orBackground(ctx)
+	parent, _ := ctx.Value(instructionKey).(*instruction)
+	inst := &instruction{id: id, parent: parent}
+	return context.WithValue(ctx, instructionKey, inst), func() {
+		atomic.StoreInt32(&inst.popped, 1)
+	}
+}
+
+// WithEventTime returns a context annotated with the event time of the element
+// being processed. Loggers configured to do so stamp the messages logged with
+// it with the event time, rather than the time they are logged, so that they
+// line up with the timeline of the data.
+func WithEventTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(orBackground(ctx), eventTimeKey, t)
+}
+
+// EventTime returns the event time of the element being processed, if the
+// context is annotated with one.
+func EventTime(ctx context.Context) (time.Time, bool) {
+	if ctx == nil {
+		return time.Time{}, false
+	}
+	t, ok := ctx.Value(eventTimeKey).(time.Time)
+	return t, ok
+}
+
+// Fields are structured key-value pairs attached to log messages.
+type Fields map[string]string
+
+// WithFields returns a context that attaches the given fields to all messages
+// logged with it, in addition to any fields already attached to ctx. Fields
+// given here override inherited fields with the same key.
+func WithFields(ctx context.Context, fields Fields) context.Context {
+	ctx = orBackground(ctx)
+	inherited, _ := ctx.Value(fieldsKey).(Fields)
+	merged := make(Fields, len(inherited)+len(fields))
+	for k, v := range inherited {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey, merged)
+}
+
+// WithDefaultFields returns a context that attaches the given fields to all
+// messages logged with it, unless they are overridden by fields attached with
+// WithFields, whether before or after. It is meant for the fields set once at
+// the start of a bundle, such as its stage, which every message logged while
+// processing it inherits. Default fields given here override the inherited
+// default fields with the same key.
+func WithDefaultFields(ctx context.Context, fields Fields) context.Context {
+	ctx = orBackground(ctx)
+	inherited, _ := ctx.Value(defaultsKey).(Fields)
+	merged := make(Fields, len(inherited)+len(fields))
+	for k, v := range inherited {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, defaultsKey, merged)
+}
+
+// FieldsFromContext returns the fields attached to the context, if any,
+// including its default fields and the path of its scopes. A nil context has
+// none. The returned map must not be modified.
+func FieldsFromContext(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey).(Fields)
+	if defaults, _ := ctx.Value(defaultsKey).(Fields); len(defaults) > 0 {
+		merged := make(Fields, len(defaults)+len(fields))
+		for k, v := range defaults {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		fields = merged
+	}
+	s, ok := ctx.Value(scopeKey).(*scope)
+	if !ok {
+		return fields
+	}
+	path := s.path()
+	if path == "" {
+		return fields
+	}
+	withScope := make(Fields, len(fields)+1)
+	for k, v := range fields {
+		withScope[k] = v
+	}
+	withScope[ScopeField] = path
+	return withScope
+}
+
+// metadataKeys are the context keys copied by CopyContextMetadata.
+var metadataKeys = []interface{}{fieldsKey, defaultsKey, instructionKey, eventTimeKey, scopeKey}
+
+// RegisterContextKey registers a context key whose value is copied by
+// CopyContextMetadata, such as an identifier that loggers attach to messages.
+// Intended to be called during initialization only.
+func RegisterContextKey(key interface{}) {
+	metadataKeys = append(metadataKeys, key)
+}
+
+// CopyContextMetadata returns child annotated with the logging metadata of
+// parent, such as its fields and the instruction and transform being
+// processed. Goroutines spawned by user code with a context that doesn't
+// derive from the one given to the DoFn can use it, so that the messages they
+// log stay correlated with the work that spawned them:
+//
+//	go func() {
+//	    ctx := log.CopyContextMetadata(ctx, context.Background())
+//	    ...
+//	}()
+//
+// A nil parent has no metadata, and a nil child is taken to be
+// context.Background().
+func CopyContextMetadata(parent, child context.Context) context.Context {
+	child = orBackground(child)
+	if parent == nil {
+		return child
+	}
+	for _, key := range metadataKeys {
+		if v := parent.Value(key); v != nil && v != "" {
+			child = context.WithValue(child, key, v)
+		}
+	}
+	return child
+}
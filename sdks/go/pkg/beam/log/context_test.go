@@ -0,0 +1,160 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPushInstructionID(t *testing.T) {
+	base := WithInstructionID(context.Background(), "base")
+	outer, popOuter := PushInstructionID(base, "outer")
+	inner, popInner := PushInstructionID(outer, "inner")
+
+	check := func(ctx context.Context, want string) {
+		t.Helper()
+		if id, _ := InstructionID(ctx); id != want {
+			t.Errorf("InstructionID() = %q, want %q", id, want)
+		}
+	}
+	check(base, "base")
+	check(outer, "outer")
+	check(inner, "inner")
+	copied := CopyContextMetadata(inner, context.Background())
+	check(copied, "inner")
+
+	// Popping restores the outer instruction for the contexts that saw the
+	// push.
+	popInner()
+	check(inner, "outer")
+	check(copied, "outer")
+	popOuter()
+	check(inner, "base")
+	check(outer, "base")
+
+	// Popping an outer instruction first leaves the inner one in place,
+	// until it is popped too.
+	outer, popOuter = PushInstructionID(base, "outer")
+	inner, popInner = PushInstructionID(outer, "inner")
+	popOuter()
+	check(inner, "inner")
+	popInner()
+	check(inner, "base")
+
+	// WithInstructionID replaces the pushed instructions.
+	check(WithInstructionID(inner, "other"), "other")
+	pushed, _ := PushInstructionID(context.Background(), "outer")
+	check(WithInstructionID(pushed, "inner"), "inner")
+}
+
+func TestPushInstructionIDSiblings(t *testing.T) {
+	outer, pop := PushInstructionID(context.Background(), "outer")
+	defer pop()
+
+	// Goroutines pushing and popping instructions from the same context don't
+	// see each other's.
+	var wg sync.WaitGroup
+	errs := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			want := fmt.Sprintf("inner%d", i)
+			for j := 0; j < 100; j++ {
+				ctx, pop := PushInstructionID(outer, want)
+				if id, _ := InstructionID(ctx); id != want {
+					errs <- fmt.Sprintf("InstructionID() = %q, want %q", id, want)
+					return
+				}
+				pop()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if id, _ := InstructionID(outer); id != "outer" {
+		t.Errorf("InstructionID(outer) = %q, want %q", id, "outer")
+	}
+}
+
+func TestWithDefaultFields(t *testing.T) {
+	ctx := WithFields(context.Background(), Fields{"user": "a"})
+	ctx = WithDefaultFields(ctx, Fields{"stage": "s1", "bundle_id": "b1", "user": "default"})
+	ctx = WithDefaultFields(ctx, Fields{"stage": "s2"})
+
+	// Fields attached with WithFields win over the defaults, even if they
+	// were attached first.
+	want := Fields{"stage": "s2", "bundle_id": "b1", "user": "a"}
+	if got := FieldsFromContext(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldsFromContext() = %v, want %v", got, want)
+	}
+	inner := WithFields(ctx, Fields{"bundle_id": "override"})
+	want = Fields{"stage": "s2", "bundle_id": "override", "user": "a"}
+	if got := FieldsFromContext(inner); !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldsFromContext(inner) = %v, want %v", got, want)
+	}
+
+	copied := CopyContextMetadata(ctx, context.Background())
+	want = Fields{"stage": "s2", "bundle_id": "b1", "user": "a"}
+	if got := FieldsFromContext(copied); !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldsFromContext(copied) = %v, want %v", got, want)
+	}
+}
+
+func TestNilContext(t *testing.T) {
+	var ctx context.Context // nil
+	parent := WithFields(context.Background(), Fields{"user": "x"})
+	tests := []struct {
+		name string
+		fn   func() context.Context
+		want Fields
+	}{
+		{"WithFields", func() context.Context { return WithFields(ctx, Fields{"a": "1"}) }, Fields{"a": "1"}},
+		{"WithDefaultFields", func() context.Context { return WithDefaultFields(ctx, Fields{"a": "1"}) }, Fields{"a": "1"}},
+		{"BeginScope", func() context.Context {
+			c, _ := BeginScope(ctx, "stage")
+			return c
+		}, Fields{ScopeField: "stage"}},
+		{"PushInstructionID", func() context.Context {
+			c, _ := PushInstructionID(ctx, "inst")
+			return c
+		}, nil},
+		{"CopyContextMetadata parent", func() context.Context { return CopyContextMetadata(ctx, context.Background()) }, nil},
+		{"CopyContextMetadata child", func() context.Context { return CopyContextMetadata(parent, ctx) }, Fields{"user": "x"}},
+	}
+	for _, test := range tests {
+		got := test.fn()
+		if got == nil {
+			t.Errorf("%v(nil) returned a nil context", test.name)
+			continue
+		}
+		if fields := FieldsFromContext(got); !reflect.DeepEqual(fields, test.want) {
+			t.Errorf("%v(nil) has fields %v, want %v", test.name, fields, test.want)
+		}
+	}
+	if c, _ := PushInstructionID(ctx, "inst"); c != nil {
+		if id, ok := InstructionID(c); !ok || id != "inst" {
+			t.Errorf("InstructionID(PushInstructionID(nil, inst)) = %q, %v, want inst", id, ok)
+		}
+	}
+}
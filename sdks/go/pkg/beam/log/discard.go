@@ -0,0 +1,41 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import "context"
+
+// Discard is a Logger that drops all messages. Since it reports every
+// severity as disabled, the logging functions don't even format their
+// arguments, so with
+//
+//	log.SetLogger(log.Discard)
+//
+// logging costs little more than the calls, which makes it a baseline for
+// benchmarks and a way to disable logging entirely. Fatal and Exit still
+// panic and exit.
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Log(ctx context.Context, sev Severity, calldepth int, msg string) {}
+
+func (discard) Enabled(ctx context.Context, sev Severity) bool {
+	return false
+}
+
+func (discard) Flush(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,51 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiscard(t *testing.T) {
+	prev := GetLogger()
+	defer SetLogger(prev)
+	SetLogger(Discard)
+
+	ctx := context.Background()
+	if Enabled(ctx, SevError) {
+		t.Error("Enabled(SevError) = true, want false")
+	}
+	v := &struct{ n int }{42}
+	if n := testing.AllocsPerRun(100, func() {
+		Infof(ctx, "processing %v", v)
+		Error(ctx, "failed")
+	}); n != 0 {
+		t.Errorf("logging to Discard allocated %v times, want 0", n)
+	}
+}
+
+func BenchmarkDiscard(b *testing.B) {
+	prev := GetLogger()
+	defer SetLogger(prev)
+	SetLogger(Discard)
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Infof(ctx, "element %d", i)
+	}
+}
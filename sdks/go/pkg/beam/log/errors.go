@@ -0,0 +1,55 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+)
+
+// maxErrorCauses bounds the causes attached by ErrorFields, in case of a
+// cyclic chain.
+const maxErrorCauses = 32
+
+// ErrorFields returns the causes of err, as found by their Unwrap methods, as
+// the fields cause_1, for the error err wraps, cause_2, for the error that one
+// wraps, and so on, down to the root cause. It returns nil if err wraps no
+// error.
+func ErrorFields(err error) Fields {
+	var fields Fields
+	for i := 1; i <= maxErrorCauses; i++ {
+		if err = unwrap(err); err == nil {
+			break
+		}
+		if fields == nil {
+			fields = Fields{}
+		}
+		fields[fmt.Sprintf("cause_%d", i)] = err.Error()
+	}
+	return fields
+}
+
+// unwrap returns the error err wraps, as reported by its Unwrap method, such
+// as for errors wrapped with the %w verb of fmt.Errorf, or nil if it has none.
+// It is errors.Unwrap, which isn't available before Go 1.13.
+func unwrap(err error) error {
+	u, ok := err.(interface {
+		Unwrap() error
+	})
+	if !ok {
+		return nil
+	}
+	return u.Unwrap()
+}
@@ -0,0 +1,86 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fieldsLogger keeps the message and fields of the last message logged to it.
+type fieldsLogger struct {
+	msg    string
+	fields Fields
+}
+
+func (f *fieldsLogger) Log(ctx context.Context, sev Severity, calldepth int, msg string) {
+	f.msg, f.fields = msg, FieldsFromContext(ctx)
+}
+
+// wrapError is an error that wraps another, as fmt.Errorf does with the %w
+// verb since Go 1.13.
+type wrapError struct {
+	msg string
+	err error
+}
+
+func (e wrapError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e wrapError) Unwrap() error {
+	return e.err
+}
+
+func TestErrorFields(t *testing.T) {
+	root := errors.New("connection refused")
+	mid := wrapError{"dial", root}
+	err := wrapError{"write failed", mid}
+
+	want := Fields{"cause_1": "dial: connection refused", "cause_2": "connection refused"}
+	if got := ErrorFields(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("ErrorFields(%v) = %v, want %v", err, got, want)
+	}
+	if got := ErrorFields(root); got != nil {
+		t.Errorf("ErrorFields(%v) = %v, want nil", root, got)
+	}
+}
+
+func TestErrorCauses(t *testing.T) {
+	prev := GetLogger()
+	defer SetLogger(prev)
+	l := &fieldsLogger{}
+	SetLogger(l)
+
+	ctx := WithFields(context.Background(), Fields{"user": "x"})
+	err := wrapError{"write failed", errors.New("connection refused")}
+	ErrorChain(ctx, err)
+	if l.msg != err.Error() {
+		t.Errorf("message = %q, want %q", l.msg, err.Error())
+	}
+	want := Fields{"user": "x", "cause_1": "connection refused"}
+	if !reflect.DeepEqual(l.fields, want) {
+		t.Errorf("fields = %v, want %v", l.fields, want)
+	}
+
+	// Error only formats the error.
+	Error(ctx, err)
+	if want := (Fields{"user": "x"}); l.msg != err.Error() || !reflect.DeepEqual(l.fields, want) {
+		t.Errorf("Error logged %q with fields %v, want %q with %v", l.msg, l.fields, err.Error(), want)
+	}
+}
@@ -22,11 +22,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync/atomic"
 )
 
 // Severity is the severity of the log message.
 type Severity int
 
+// The values of the severities are stable, so SevTrace and SevNotice, which
+// were added later, come last. Use AtLeast to compare severities, rather than
+// their values.
 const (
 	SevUnspecified Severity = iota
 	SevDebug
@@ -34,107 +38,349 @@ const (
 	SevWarn
 	SevError
 	SevFatal
+	SevTrace
+	SevNotice
 )
 
+// rank returns the position of the severity in the order of increasing
+// severity. Unknown severities rank above SevFatal, in the order of their
+// values.
+func (s Severity) rank() int {
+	switch s {
+	case SevUnspecified:
+		return 0
+	case SevTrace:
+		return 1
+	case SevDebug:
+		return 2
+	case SevInfo:
+		return 3
+	case SevNotice:
+		return 4
+	case SevWarn:
+		return 5
+	case SevError:
+		return 6
+	case SevFatal:
+		return 7
+	default:
+		return int(s) + 1
+	}
+}
+
+// AtLeast reports whether the severity is at least as severe as level, such
+// as whether a message passes a minimum severity.
+func (s Severity) AtLeast(level Severity) bool {
+	return s.rank() >= level.rank()
+}
+
 // Logger is a context-aware logging backend. The richer context allows for
 // more sophisticated logging setups. Must be concurrency safe.
+//
+// Calldepth identifies the call site reported as the location of a message,
+// as the number of stack frames above Log, as for runtime.Caller called from
+// Log: 1 is the caller of Log, 2 its caller, and so on. A function that logs
+// on behalf of its caller thus passes on its own calldepth plus one.
 type Logger interface {
 	// Log logs the message in some implementation-dependent way. Log should
 	// always return regardless of the severity.
 	Log(ctx context.Context, sev Severity, calldepth int, msg string)
 }
 
-var (
-	logger Logger = &Standard{}
-)
+// Skip returns a Logger that reports the call site n frames further up the
+// stack than l would, for use by code that wraps the Logger in n levels of
+// helper functions. It preserves Enabler and Flusher.
+func Skip(l Logger, n int) Logger {
+	return skipLogger{l: l, n: n}
+}
+
+type skipLogger struct {
+	l Logger
+	n int
+}
+
+func (s skipLogger) Log(ctx context.Context, sev Severity, calldepth int, msg string) {
+	s.l.Log(ctx, sev, calldepth+s.n+1, msg) // +1 for this frame
+}
+
+func (s skipLogger) Enabled(ctx context.Context, sev Severity) bool {
+	if e, ok := s.l.(Enabler); ok {
+		return e.Enabled(ctx, sev)
+	}
+	return true
+}
+
+func (s skipLogger) Flush(ctx context.Context) error {
+	if f, ok := s.l.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// logger holds the global Logger, in a holder since an atomic.Value requires
+// values of a consistent concrete type. It is swapped atomically, so that
+// messages logged while the Logger is replaced go to either the old or the new
+// one.
+var logger atomic.Value
+
+func init() {
+	logger.Store(holder{&Standard{}})
+}
+
+type holder struct {
+	l Logger
+}
 
 // SetLogger sets the global Logger. Intended to be called during initialization
-// only.
+// only, but safe to call concurrently with logging.
 func SetLogger(l Logger) {
 	if l == nil {
 		panic("Logger cannot be nil")
 	}
-	logger = l
+	logger.Store(holder{l})
+}
+
+// Flusher is implemented by Loggers that buffer messages.
+type Flusher interface {
+	// Flush blocks until all messages logged so far have been written, or
+	// until the context is done.
+	Flush(ctx context.Context) error
+}
+
+// Flush flushes the global logger, if it buffers messages. It is useful
+// before exiting or when asserting on logged messages.
+func Flush(ctx context.Context) error {
+	if f, ok := GetLogger().(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// Enabler is implemented by Loggers that discard messages below some severity.
+type Enabler interface {
+	// Enabled reports whether messages of the severity are logged.
+	Enabled(ctx context.Context, sev Severity) bool
+}
+
+// Enabled reports whether the global logger logs messages of the severity.
+// It is true unless the logger implements Enabler. The logging functions
+// below fatal severity check it before formatting their arguments, so a
+// filtered out message costs little more than the call.
+func Enabled(ctx context.Context, sev Severity) bool {
+	if e, ok := GetLogger().(Enabler); ok {
+		return e.Enabled(ctx, sev)
+	}
+	return true
+}
+
+// Binder is implemented by Loggers that can pin the logging metadata of a
+// context, such as the instruction being processed, for many messages.
+type Binder interface {
+	// With returns a Logger that logs messages with the metadata of ctx
+	// rather than that of their own context, except for their fields, which
+	// are merged over those of ctx.
+	With(ctx context.Context) Logger
+}
+
+// With returns a Logger bound to the logging metadata of ctx, if the global
+// logger implements Binder, and the global logger otherwise. It spares a tight
+// loop, such as over the elements of a bundle, looking up the metadata of the
+// context of each message:
+//
+//	l := log.With(ctx)
+//	for ... {
+//	    l.Log(ctx, log.SevDebug, 1, msg)
+//	}
+//
+// The Logger is bound to the global logger at the time of the call.
+func With(ctx context.Context) Logger {
+	l := GetLogger()
+	if b, ok := l.(Binder); ok {
+		return b.With(ctx)
+	}
+	return l
+}
+
+// Lazy is a message that is only computed if it is logged, such as
+//
+//	log.Debug(ctx, log.Lazy(func() string { return expensiveDump(state) }))
+//
+// It is a fmt.Stringer, so it can also be an argument to a format.
+type Lazy func() string
+
+func (f Lazy) String() string {
+	return f()
+}
+
+// GetLogger returns the global Logger.
+func GetLogger() Logger {
+	return logger.Load().(holder).l
 }
 
 // Output logs the given message to the global logger. Calldepth is the count
-// of the number of frames to skip when computing the file name and line number.
+// of the number of frames to skip when computing the file name and line number,
+// following the convention of Logger: 1 is the caller of Output. A helper that
+// logs on behalf of its caller passes 2.
 func Output(ctx context.Context, sev Severity, calldepth int, msg string) {
-	logger.Log(ctx, sev, calldepth+1, msg) // +1 for this frame
+	GetLogger().Log(ctx, sev, calldepth+1, msg) // +1 for this frame
 }
 
 // User-facing logging functions.
 
+// Trace writes the fmt.Sprint-formatted arguments to the global logger with
+// trace severity, which is below debug.
+func Trace(ctx context.Context, v ...interface{}) {
+	if Enabled(ctx, SevTrace) {
+		Output(ctx, SevTrace, 2, fmt.Sprint(v...))
+	}
+}
+
+// Tracef writes the fmt.Sprintf-formatted arguments to the global logger with
+// trace severity, which is below debug.
+func Tracef(ctx context.Context, format string, v ...interface{}) {
+	if Enabled(ctx, SevTrace) {
+		Output(ctx, SevTrace, 2, fmt.Sprintf(format, v...))
+	}
+}
+
+// Traceln writes the fmt.Sprintln-formatted arguments to the global logger with
+// trace severity, which is below debug.
+func Traceln(ctx context.Context, v ...interface{}) {
+	if Enabled(ctx, SevTrace) {
+		Output(ctx, SevTrace, 2, fmt.Sprintln(v...))
+	}
+}
+
 // Debug writes the fmt.Sprint-formatted arguments to the global logger with
 // debug severity.
 func Debug(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevDebug, 2, fmt.Sprint(v...))
+	if Enabled(ctx, SevDebug) {
+		Output(ctx, SevDebug, 2, fmt.Sprint(v...))
+	}
 }
 
 // Debugf writes the fmt.Sprintf-formatted arguments to the global logger with
 // debug severity.
 func Debugf(ctx context.Context, format string, v ...interface{}) {
-	Output(ctx, SevDebug, 2, fmt.Sprintf(format, v...))
+	if Enabled(ctx, SevDebug) {
+		Output(ctx, SevDebug, 2, fmt.Sprintf(format, v...))
+	}
 }
 
 // Debugln writes the fmt.Sprintln-formatted arguments to the global logger with
 // debug severity.
 func Debugln(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevDebug, 2, fmt.Sprintln(v...))
+	if Enabled(ctx, SevDebug) {
+		Output(ctx, SevDebug, 2, fmt.Sprintln(v...))
+	}
 }
 
 // Info writes the fmt.Sprint-formatted arguments to the global logger with
 // info severity.
 func Info(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevInfo, 2, fmt.Sprint(v...))
+	if Enabled(ctx, SevInfo) {
+		Output(ctx, SevInfo, 2, fmt.Sprint(v...))
+	}
 }
 
 // Infof writes the fmt.Sprintf-formatted arguments to the global logger with
 // info severity.
 func Infof(ctx context.Context, format string, v ...interface{}) {
-	Output(ctx, SevInfo, 2, fmt.Sprintf(format, v...))
+	if Enabled(ctx, SevInfo) {
+		Output(ctx, SevInfo, 2, fmt.Sprintf(format, v...))
+	}
 }
 
 // Infoln writes the fmt.Sprintln-formatted arguments to the global logger with
 // info severity.
 func Infoln(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevInfo, 2, fmt.Sprintln(v...))
+	if Enabled(ctx, SevInfo) {
+		Output(ctx, SevInfo, 2, fmt.Sprintln(v...))
+	}
+}
+
+// Notice writes the fmt.Sprint-formatted arguments to the global logger with
+// notice severity, which is for significant events above info.
+func Notice(ctx context.Context, v ...interface{}) {
+	if Enabled(ctx, SevNotice) {
+		Output(ctx, SevNotice, 2, fmt.Sprint(v...))
+	}
+}
+
+// Noticef writes the fmt.Sprintf-formatted arguments to the global logger with
+// notice severity, which is for significant events above info.
+func Noticef(ctx context.Context, format string, v ...interface{}) {
+	if Enabled(ctx, SevNotice) {
+		Output(ctx, SevNotice, 2, fmt.Sprintf(format, v...))
+	}
+}
+
+// Noticeln writes the fmt.Sprintln-formatted arguments to the global logger with
+// notice severity, which is for significant events above info.
+func Noticeln(ctx context.Context, v ...interface{}) {
+	if Enabled(ctx, SevNotice) {
+		Output(ctx, SevNotice, 2, fmt.Sprintln(v...))
+	}
 }
 
 // Warn writes the fmt.Sprint-formatted arguments to the global logger with
 // warn severity.
 func Warn(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevWarn, 2, fmt.Sprint(v...))
+	if Enabled(ctx, SevWarn) {
+		Output(ctx, SevWarn, 2, fmt.Sprint(v...))
+	}
 }
 
 // Warnf writes the fmt.Sprintf-formatted arguments to the global logger with
 // warn severity.
 func Warnf(ctx context.Context, format string, v ...interface{}) {
-	Output(ctx, SevWarn, 2, fmt.Sprintf(format, v...))
+	if Enabled(ctx, SevWarn) {
+		Output(ctx, SevWarn, 2, fmt.Sprintf(format, v...))
+	}
 }
 
 // Warnln writes the fmt.Sprintln-formatted arguments to the global logger with
 // warn severity.
 func Warnln(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevWarn, 2, fmt.Sprintln(v...))
+	if Enabled(ctx, SevWarn) {
+		Output(ctx, SevWarn, 2, fmt.Sprintln(v...))
+	}
 }
 
 // Error writes the fmt.Sprint-formatted arguments to the global logger with
 // error severity.
 func Error(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevError, 2, fmt.Sprint(v...))
+	if Enabled(ctx, SevError) {
+		Output(ctx, SevError, 2, fmt.Sprint(v...))
+	}
+}
+
+// ErrorChain writes the error to the global logger with error severity. Its
+// causes are attached as fields, as by ErrorFields, so that a log backend can
+// index them, while the message is that of the error itself.
+func ErrorChain(ctx context.Context, err error) {
+	if Enabled(ctx, SevError) {
+		if fields := ErrorFields(err); fields != nil {
+			ctx = WithFields(ctx, fields)
+		}
+		Output(ctx, SevError, 2, fmt.Sprint(err))
+	}
 }
 
 // Errorf writes the fmt.Sprintf-formatted arguments to the global logger with
 // error severity.
 func Errorf(ctx context.Context, format string, v ...interface{}) {
-	Output(ctx, SevError, 2, fmt.Sprintf(format, v...))
+	if Enabled(ctx, SevError) {
+		Output(ctx, SevError, 2, fmt.Sprintf(format, v...))
+	}
 }
 
 // Errorln writes the fmt.Sprintln-formatted arguments to the global logger with
 // error severity.
 func Errorln(ctx context.Context, v ...interface{}) {
-	Output(ctx, SevError, 2, fmt.Sprintln(v...))
+	if Enabled(ctx, SevError) {
+		Output(ctx, SevError, 2, fmt.Sprintln(v...))
+	}
 }
 
 // Fatal writes the fmt.Sprint-formatted arguments to the global logger with
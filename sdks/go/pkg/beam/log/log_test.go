@@ -0,0 +1,100 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingLogger counts the messages logged to it.
+type countingLogger struct {
+	n int64
+}
+
+func (c *countingLogger) Log(ctx context.Context, sev Severity, calldepth int, msg string) {
+	atomic.AddInt64(&c.n, 1)
+}
+
+// TestSetLoggerConcurrently swaps the global Logger while logging from other
+// goroutines. Run with -race, it checks that the swaps are atomic.
+func TestSetLoggerConcurrently(t *testing.T) {
+	prev := GetLogger()
+	defer SetLogger(prev)
+
+	loggers := []*countingLogger{{}, {}}
+	SetLogger(loggers[0])
+
+	const logs, swaps = 1000, 100
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < logs; j++ {
+				Info(ctx, "msg")
+				Flush(ctx)
+			}
+		}()
+	}
+	for i := 0; i < swaps; i++ {
+		SetLogger(loggers[i%2])
+	}
+	wg.Wait()
+
+	// Each message went to exactly one of the loggers.
+	if got := atomic.LoadInt64(&loggers[0].n) + atomic.LoadInt64(&loggers[1].n); got != 4*logs {
+		t.Errorf("logged %v messages, want %v", got, 4*logs)
+	}
+}
+
+func TestSeverityValues(t *testing.T) {
+	// The values are persisted, and compared, outside of this package, so
+	// they must not change.
+	tests := []struct {
+		sev  Severity
+		want int
+	}{
+		{SevUnspecified, 0},
+		{SevDebug, 1},
+		{SevInfo, 2},
+		{SevWarn, 3},
+		{SevError, 4},
+		{SevFatal, 5},
+		{SevTrace, 6},
+		{SevNotice, 7},
+	}
+	for _, test := range tests {
+		if got := int(test.sev); got != test.want {
+			t.Errorf("value of severity %v = %v, want %v", test.sev, got, test.want)
+		}
+	}
+}
+
+func TestSeverityAtLeast(t *testing.T) {
+	// The severities in increasing order.
+	order := []Severity{SevUnspecified, SevTrace, SevDebug, SevInfo, SevNotice, SevWarn, SevError, SevFatal}
+	for i, sev := range order {
+		for j, level := range order {
+			if got, want := sev.AtLeast(level), i >= j; got != want {
+				t.Errorf("%v.AtLeast(%v) = %v, want %v", sev, level, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+)
+
+// ScopeField is the field holding the path of the scopes begun with
+// BeginScope. Intended to be changed during initialization only.
+var ScopeField = "scope"
+
+const scopeKey contextKey = "beam:log:scope"
+
+// scope is a named scope, nested in its parent, if any.
+type scope struct {
+	name   string
+	parent *scope
+	// ended is set, atomically, once the scope is ended.
+	ended int32
+}
+
+// BeginScope returns a context whose messages carry the name of the scope, in
+// the ScopeField field, until done is called. Scopes nest, so the field is the
+// path of the scopes that haven't ended, outermost first, such as
+//
+//	ctx, end := log.BeginScope(ctx, "stage")
+//	defer end()
+//	...
+//	ctx, done := log.BeginScope(ctx, "bundle")
+//	log.Info(ctx, "processing") // scope=stage/bundle
+//	done()
+//
+// The field overrides one set with WithFields.
+func BeginScope(ctx context.Context, name string) (context.Context, func()) {
+	ctx = orBackground(ctx)
+	parent, _ := ctx.Value(scopeKey).(*scope)
+	s := &scope{name: name, parent: parent}
+	return context.WithValue(ctx, scopeKey, s), func() {
+		atomic.StoreInt32(&s.ended, 1)
+	}
+}
+
+// path returns the names of the scopes that haven't ended, outermost first,
+// separated by slashes.
+func (s *scope) path() string {
+	var names []string
+	for ; s != nil; s = s.parent {
+		if atomic.LoadInt32(&s.ended) == 0 {
+			names = append(names, s.name)
+		}
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, "/")
+}
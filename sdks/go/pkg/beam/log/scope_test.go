@@ -0,0 +1,60 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBeginScope(t *testing.T) {
+	ctx := context.Background()
+	pipeline, endPipeline := BeginScope(ctx, "pipeline")
+	stage, endStage := BeginScope(WithFields(pipeline, Fields{"user": "x"}), "stage")
+	bundle, endBundle := BeginScope(stage, "bundle")
+
+	scopeOf := func(ctx context.Context) string {
+		return FieldsFromContext(ctx)[ScopeField]
+	}
+	if got, want := scopeOf(bundle), "pipeline/stage/bundle"; got != want {
+		t.Errorf("scope = %q, want %q", got, want)
+	}
+	if got := FieldsFromContext(bundle)["user"]; got != "x" {
+		t.Errorf("user = %q, want %q", got, "x")
+	}
+
+	// An ended scope is left out, even in nested contexts.
+	endStage()
+	if got, want := scopeOf(bundle), "pipeline/bundle"; got != want {
+		t.Errorf("scope once the stage ended = %q, want %q", got, want)
+	}
+	endBundle()
+	endPipeline()
+	if got := scopeOf(bundle); got != "" {
+		t.Errorf("scope once all ended = %q, want none", got)
+	}
+
+	// Scopes are copied with the rest of the metadata.
+	copied := CopyContextMetadata(pipeline, context.Background())
+	if got := scopeOf(copied); got != "" {
+		t.Errorf("scope of ended pipeline = %q, want none", got)
+	}
+	active, done := BeginScope(ctx, "active")
+	defer done()
+	if got := scopeOf(CopyContextMetadata(active, context.Background())); got != "active" {
+		t.Errorf("copied scope = %q, want %q", got, "active")
+	}
+}
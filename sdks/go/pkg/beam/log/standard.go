@@ -27,10 +27,15 @@ type Standard struct {
 	Level Severity
 }
 
+// Enabled reports whether messages of the severity are logged.
+func (s *Standard) Enabled(ctx context.Context, sev Severity) bool {
+	return sev.AtLeast(s.Level)
+}
+
 // Log logs the message to the standard Go logger. For Panic, it does not
 // perform the os.Exit(1) call, but defers to the log wrapper.
 func (s *Standard) Log(ctx context.Context, sev Severity, calldepth int, msg string) {
-	if sev < s.Level {
+	if !sev.AtLeast(s.Level) {
 		return
 	}
 	stdlog.Output(calldepth+1, msg)
@@ -0,0 +1,44 @@
+// Licensed to the Apache Software Foundation (ASF) under one or more
+// contributor license agreements.  See the NOTICE file distributed with
+// this work for additional information regarding copyright ownership.
+// The ASF licenses this file to You under the Apache License, Version 2.0
+// (the "License"); you may not use this file except in compliance with
+// the License.  You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"time"
+)
+
+// DurationField is the field holding the elapsed time in the messages logged
+// by TimeOp. Intended to be changed during initialization only.
+var DurationField = "duration"
+
+// TimeOp returns a function that logs the name of the operation with info
+// severity, along with the time elapsed since TimeOp was called as the
+// DurationField field. It is meant to time a function with
+//
+//	defer log.TimeOp(ctx, "processBundle")()
+//
+// The message has the fields of ctx and is correlated with its instruction,
+// like any other. Its location is the caller of the returned function.
+func TimeOp(ctx context.Context, op string) func() {
+	start := time.Now()
+	return func() {
+		if !Enabled(ctx, SevInfo) {
+			return
+		}
+		elapsed := time.Since(start)
+		Output(WithFields(ctx, Fields{DurationField: elapsed.String()}), SevInfo, 2, op)
+	}
+}
@@ -17,6 +17,7 @@ package grpcx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -27,13 +28,41 @@ import (
 // to provide a customized dialing behavior.
 var Dial = DefaultDial
 
+// DialWithOptions is Dial with additional dial options, such as keepalive
+// parameters. It can be overridden along with Dial. A customized dialer that
+// can't apply the options returns ErrDialOptions.
+var DialWithOptions = DefaultDialWithOptions
+
+// ErrDialOptions is returned by DialWithOptions if the dial options can't be
+// applied, since Dial was customized without it. Dialing without the options
+// may still succeed.
+var ErrDialOptions = errors.New("dial options not supported by the customized dialer")
+
+// dialWithoutOptions returns a DialWithOptions for the dialer, which only
+// dials if there are no options to apply.
+func dialWithoutOptions(dial func(context.Context, string, time.Duration) (*grpc.ClientConn, error)) func(context.Context, string, time.Duration, ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return func(ctx context.Context, endpoint string, timeout time.Duration, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+		if len(opts) > 0 {
+			return nil, ErrDialOptions
+		}
+		return dial(ctx, endpoint, timeout)
+	}
+}
+
 // DefaultDial is a dialer that specifies an insecure blocking connection with a timeout.
 func DefaultDial(ctx context.Context, endpoint string, timeout time.Duration) (*grpc.ClientConn, error) {
+	return DefaultDialWithOptions(ctx, endpoint, timeout)
+}
+
+// DefaultDialWithOptions is DefaultDial with additional dial options, such as
+// keepalive parameters.
+func DefaultDialWithOptions(ctx context.Context, endpoint string, timeout time.Duration, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cc, err := grpc.DialContext(ctx, endpoint, grpc.WithInsecure(), grpc.WithBlock(),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(50<<20)))
+	opts = append([]grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(50 << 20))}, opts...)
+	cc, err := grpc.DialContext(ctx, endpoint, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial server at %v: %v", endpoint, err)
 	}
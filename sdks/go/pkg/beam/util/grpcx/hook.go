@@ -31,6 +31,10 @@ import (
 type Hook struct {
 	// Dialer allows the runner to customize the gRPC dialing behavior.
 	Dialer func(context.Context, string, time.Duration) (*grpc.ClientConn, error)
+	// DialerWithOptions allows the runner to customize the gRPC dialing
+	// behavior when additional dial options are requested. If only Dialer is
+	// supplied, such requests fail with ErrDialOptions.
+	DialerWithOptions func(context.Context, string, time.Duration, ...grpc.DialOption) (*grpc.ClientConn, error)
 	// TODO(wcn): expose other hooks here.
 }
 
@@ -59,6 +63,10 @@ func RegisterHook(name string, c HookFactory) {
 				grpcHook := hookRegistry[name](opts)
 				if grpcHook.Dialer != nil {
 					Dial = grpcHook.Dialer
+					DialWithOptions = dialWithoutOptions(grpcHook.Dialer)
+				}
+				if grpcHook.DialerWithOptions != nil {
+					DialWithOptions = grpcHook.DialerWithOptions
 				}
 				return ctx, nil
 			},
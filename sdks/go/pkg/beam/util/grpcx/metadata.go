@@ -29,6 +29,17 @@ const idKey = "worker_id"
 // ReadWorkerID reads the worker ID from an incoming gRPC request context.
 func ReadWorkerID(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
+	return readWorkerID(md, ok)
+}
+
+// ReadOutgoingWorkerID reads the worker ID from an outgoing gRPC request
+// context, as written by WriteWorkerID.
+func ReadOutgoingWorkerID(ctx context.Context) (string, error) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	return readWorkerID(md, ok)
+}
+
+func readWorkerID(md metadata.MD, ok bool) (string, error) {
 	if !ok {
 		return "", errors.New("failed to read metadata from context")
 	}
@@ -53,3 +64,14 @@ func WriteWorkerID(ctx context.Context, id string) context.Context {
 	}
 	return metadata.NewOutgoingContext(ctx, md)
 }
+
+// WriteMetadata writes the key-value pairs to an outgoing gRPC request context,
+// such as to attach them once to a stream rather than to each message. Keys
+// are lowercased. It merges the information with any existing gRPC metadata.
+func WriteMetadata(ctx context.Context, kv map[string]string) context.Context {
+	md := metadata.New(kv)
+	if old, ok := metadata.FromOutgoingContext(ctx); ok {
+		md = metadata.Join(md, old)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}